@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/devem-tech/up-to-date/internal/app"
+)
+
+// runApprovalCommand implements the approvals, approve and reject subcommands.
+func runApprovalCommand(cmd string, args []string) int {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	stateDir := fs.String("state-dir", "", "Directory the updater keeps its state in")
+	fs.Usage = func() {
+		if cmd == "approvals" {
+			fmt.Fprintf(os.Stderr, "Usage: %s approvals --state-dir=DIR\n", os.Args[0])
+		} else {
+			fmt.Fprintf(os.Stderr, "Usage: %s %s --state-dir=DIR CONTAINER...\n", os.Args[0], cmd)
+		}
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *stateDir == "" {
+		fmt.Fprintln(os.Stderr, "❌ error: --state-dir is required")
+		return 2
+	}
+
+	if cmd == "approvals" {
+		list, err := app.ListApprovals(*stateDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ error: %v\n", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CONTAINER\tIMAGE\tCURRENT\tTARGET\tSTATUS\tEXPIRES")
+		for _, a := range list {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", a.Container, a.Image, a.Current, a.Target, a.Status, a.Expires.UTC().Format(time.RFC3339))
+		}
+		w.Flush()
+		return 0
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	code := 0
+	for _, name := range fs.Args() {
+		a, err := app.DecideApproval(*stateDir, name, cmd == "approve")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ error: %v\n", err)
+			code = 1
+			continue
+		}
+		fmt.Printf("%s: %s (%s)\n", a.Container, a.Status, a.Target)
+	}
+	return code
+}
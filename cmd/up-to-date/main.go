@@ -20,8 +20,26 @@ import (
 
 const appVersion = "0.5.2"
 
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
 func main() {
-	var cfg app.Config
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "approvals", "approve", "reject":
+			os.Exit(runApprovalCommand(os.Args[1], os.Args[2:]))
+		case "self-handoff":
+			os.Exit(runSelfHandoff(os.Args[2:]))
+		}
+	}
+
+	cfg := app.Config{Version: appVersion}
 	var logLevelStr string
 	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
@@ -43,10 +61,45 @@ func main() {
 	fs.BoolVar(&cfg.Cleanup, "cleanup", false, "Remove old images for updated containers")
 	fs.BoolVar(&cfg.LabelEnable, "label-enable", false, "Update only containers that have label")
 	fs.StringVar(&cfg.Label, "label", "devem.tech/up-to-date.enabled=true", "Label selector for --label-enable (key or key=value)")
+	var excludeLabels stringList
+	var includePatterns, excludePatterns stringList
+	fs.Var(&includePatterns, "include", "Only update containers whose name or image matches (wildcard or /regexp/, repeatable)")
+	fs.Var(&excludePatterns, "exclude", "Never update containers whose name or image matches (wildcard or /regexp/, repeatable)")
+	fs.Var(&excludeLabels, "exclude-label", "Label selector for containers to never update (key or key=value, repeatable); "+app.DefaultExcludeLabel+" is always honoured")
+
+	var allowRegistries, allowImages, denyRegistries, denyImages stringList
+	fs.Var(&allowRegistries, "allow-registry", "Only pull from this registry or registry/namespace, e.g. ghcr.io/our-org (repeatable)")
+	fs.Var(&allowImages, "allow-image", "Only pull this image repository, * allowed (repeatable)")
+	fs.Var(&denyRegistries, "deny-registry", "Never pull from this registry or registry/namespace (repeatable)")
+	fs.Var(&denyImages, "deny-image", "Never pull this image repository, e.g. docker.io/library/postgres (repeatable)")
+	fs.BoolVar(&cfg.ComposeGroups, "compose-groups", false, "Update each compose project as one unit and roll it back if any service fails")
+	fs.BoolVar(&cfg.IncludeStopped, "include-stopped", false, "Also update stopped containers (recreated without starting)")
+	fs.BoolVar(&cfg.IncludeRestarting, "include-restarting", true, "Also update containers that are currently restarting")
+	fs.StringVar(&cfg.Scope, "scope", "", "Manage only containers whose devem.tech/up-to-date.scope label equals this value")
 
 	fs.StringVar(&cfg.DockerConfigPath, "docker-config", "", "Path to docker config.json for registry auth (optional)")
 
+	fs.BoolVar(&cfg.MonitorOnly, "monitor-only", false, "Only report available updates, never recreate containers")
+	fs.StringVar(&cfg.MonitorLabel, "monitor-label", "devem.tech/up-to-date.monitor-only=true", "Label selector for monitor-only containers (key or key=value)")
+	fs.BoolVar(&cfg.MonitorPull, "monitor-pull", false, "Pull new images for monitor-only containers instead of only resolving the digest")
+	fs.DurationVar(&cfg.MinImageAge, "min-image-age", 0, "Hold updates until the new image is at least this old (e.g. 1h, 0 to disable)")
+	fs.DurationVar(&cfg.ShutdownGrace, "shutdown-grace", time.Minute, "How long to let an in-flight update finish after SIGTERM")
+	fs.StringVar(&cfg.ApprovalLabel, "approval-label", "devem.tech/up-to-date.approval=true", "Label selector for containers whose updates wait for approval (key or key=value)")
+	fs.DurationVar(&cfg.ApprovalTTL, "approval-ttl", 7*24*time.Hour, "How long a pending approval stays valid")
+	fs.StringVar(&cfg.StateDir, "state-dir", "", "Directory to keep state across restarts (optional)")
+
 	fs.StringVar(&cfg.RollingLabel, "rolling-label", "devem.tech/up-to-date.rolling=true", "Label selector to enable rolling updates (key or key=value)")
+	fs.BoolVar(&cfg.WatchEvents, "events", false, "Watch Docker events and check new containers and pulled images immediately")
+	fs.StringVar(&cfg.WebhookAddr, "webhook-addr", "", "Listen address for registry push webhooks, e.g. :8080 (optional)")
+	var notifyEvents, notifyMinSeverity string
+	fs.StringVar(&notifyEvents, "notify-events", app.DefaultNotifyEvents, "Events to notify about unless a notifier sets <PREFIX>_EVENTS: available, updated, failed, transient, rollback, session-error, startup, shutdown or all")
+	fs.StringVar(&notifyMinSeverity, "notify-min-severity", "info", "Lowest severity to notify about unless a notifier sets <PREFIX>_MIN_SEVERITY: info, warning, error")
+	fs.IntVar(&cfg.NotifyTransientAfter, "notify-transient-after", 3, "Consecutive transient failures of a container before the transient event fires")
+	fs.DurationVar(&cfg.NotifyDigest, "notify-digest", 0, "Hold updates and send them as one digest at this interval (e.g. 1h, 0 to disable)")
+	fs.StringVar(&cfg.NotifyDigestAt, "notify-digest-at", "", "Hold updates and send them as one digest daily at this local time (HH:MM)")
+	fs.DurationVar(&cfg.NotifyQueueTTL, "notify-queue-ttl", 24*time.Hour, "How long undelivered notifications are retried (kept across restarts with --state-dir)")
+	fs.StringVar(&cfg.NotifyTemplate, "notify-template", "", "Go template file for notification text; .html files use html/template (optional)")
+	fs.StringVar(&cfg.Host, "notify-host", "", "Host name shown in notifications (default: hostname)")
 	fs.StringVar(&logLevelStr, "log-level", "info", "Log level: debug, info, warn, error")
 	if err := fs.Parse(os.Args[1:]); err != nil {
 		if err == flag.ErrHelp {
@@ -56,12 +109,93 @@ func main() {
 		usageError("%v", err)
 	}
 
+	cfg.Names = fs.Args()
+	for _, v := range includePatterns {
+		p, err := app.ParsePattern(v)
+		if err != nil {
+			usageError("include: %v", err)
+		}
+		cfg.Include = append(cfg.Include, p)
+	}
+	for _, v := range excludePatterns {
+		p, err := app.ParsePattern(v)
+		if err != nil {
+			usageError("exclude: %v", err)
+		}
+		cfg.Exclude = append(cfg.Exclude, p)
+	}
+
+	cfg.Policy = app.ImagePolicy{
+		AllowRegistries: allowRegistries,
+		AllowImages:     allowImages,
+		DenyRegistries:  denyRegistries,
+		DenyImages:      denyImages,
+	}
+	if err := cfg.Policy.Validate(); err != nil {
+		usageError("image policy: %v", err)
+	}
+
+	cfg.Scope = strings.TrimSpace(cfg.Scope)
+	cfg.ExcludeLabels = append([]string{app.DefaultExcludeLabel}, excludeLabels...)
+
 	if cfg.Interval <= 0 {
 		usageError("interval must be positive")
 	}
+	if cfg.ShutdownGrace < 0 {
+		usageError("shutdown-grace must not be negative")
+	}
+	if cfg.ApprovalTTL <= 0 {
+		usageError("approval-ttl must be positive")
+	}
+	if cfg.MinImageAge < 0 {
+		usageError("min-image-age must not be negative")
+	}
+	if cfg.NotifyTransientAfter < 1 {
+		usageError("notify-transient-after must be positive")
+	}
+	if cfg.NotifyQueueTTL <= 0 {
+		usageError("notify-queue-ttl must be positive")
+	}
+	if cfg.NotifyDigest < 0 {
+		usageError("notify-digest must not be negative")
+	}
+	if cfg.NotifyDigestAt != "" {
+		if cfg.NotifyDigest > 0 {
+			usageError("--notify-digest and --notify-digest-at are mutually exclusive")
+		}
+		if _, err := app.ParseClock(cfg.NotifyDigestAt); err != nil {
+			usageError("notify-digest-at: %v", err)
+		}
+	}
+	defaultEvents, err := app.ParseEvents(notifyEvents)
+	if err != nil {
+		usageError("notify-events: %v", err)
+	}
+	defaultMinSeverity, err := app.ParseSeverity(notifyMinSeverity)
+	if err != nil {
+		usageError("notify-min-severity: %v", err)
+	}
+	if cfg.WebhookAddr != "" {
+		cfg.WebhookSecret = strings.TrimSpace(os.Getenv("WEBHOOK_SECRET"))
+		if cfg.WebhookSecret == "" {
+			usageError("--webhook-addr requires WEBHOOK_SECRET to be set")
+		}
+	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
+	// First signal stops scheduling new work, second one aborts the update in flight.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	abortCtx, abort := context.WithCancel(context.Background())
+	defer abort()
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		<-sigs
+		cancel()
+		<-sigs
+		abort()
+	}()
 
 	parsedLogLevel, err := app.ParseLogLevel(logLevelStr)
 	if err != nil {
@@ -90,13 +224,124 @@ func main() {
 	slog.Info("--interval=" + cfg.Interval.String())
 	slog.Info("--cleanup=" + fmt.Sprintf("%t", cfg.Cleanup))
 	slog.Info("--label-enable=" + fmt.Sprintf("%t", cfg.LabelEnable))
+	slog.Info("--monitor-only=" + fmt.Sprintf("%t", cfg.MonitorOnly))
+	if cfg.MinImageAge > 0 {
+		slog.Info("--min-image-age=" + cfg.MinImageAge.String())
+	}
+	if cfg.StateDir != "" {
+		slog.Info("--state-dir=" + cfg.StateDir)
+	}
+	slog.Info("--shutdown-grace=" + cfg.ShutdownGrace.String())
+	slog.Info("--compose-groups=" + fmt.Sprintf("%t", cfg.ComposeGroups))
+	slog.Info("--include-stopped=" + fmt.Sprintf("%t", cfg.IncludeStopped))
+	if cfg.Scope != "" {
+		slog.Info("--scope=" + cfg.Scope)
+	}
+	if len(cfg.Names) > 0 {
+		slog.Info("containers: " + strings.Join(cfg.Names, ", "))
+	}
+	if len(includePatterns) > 0 {
+		slog.Info("--include=" + includePatterns.String())
+	}
+	if len(excludePatterns) > 0 {
+		slog.Info("--exclude=" + excludePatterns.String())
+	}
+	for _, l := range []struct {
+		flag string
+		list stringList
+	}{
+		{"allow-registry", allowRegistries},
+		{"allow-image", allowImages},
+		{"deny-registry", denyRegistries},
+		{"deny-image", denyImages},
+	} {
+		if len(l.list) > 0 {
+			slog.Info("--" + l.flag + "=" + l.list.String())
+		}
+	}
+	if len(excludeLabels) > 0 {
+		slog.Info("--exclude-label=" + excludeLabels.String())
+	}
+	slog.Info("--events=" + fmt.Sprintf("%t", cfg.WatchEvents))
+	if cfg.WebhookAddr != "" {
+		slog.Info("--webhook-addr=" + cfg.WebhookAddr)
+	}
+	if cfg.NotifyTemplate != "" {
+		slog.Info("--notify-template=" + cfg.NotifyTemplate)
+	}
+
+	if cfg.Host == "" {
+		cfg.Host, _ = os.Hostname()
+	}
+	slog.Info("--notify-events=" + notifyEvents)
+	if cfg.NotifyDigest > 0 {
+		slog.Info("--notify-digest=" + cfg.NotifyDigest.String())
+	}
+	if cfg.NotifyDigestAt != "" {
+		slog.Info("--notify-digest-at=" + cfg.NotifyDigestAt)
+	}
+	for _, n := range []struct {
+		name   string
+		prefix string
+		new    func() (app.Notifier, error)
+	}{
+		{"telegram", "TELEGRAM", app.NewTelegramNotifierFromEnv},
+		{"slack", "SLACK", app.NewSlackNotifierFromEnv},
+		{"discord", "DISCORD", app.NewDiscordNotifierFromEnv},
+		{"matrix", "MATRIX", app.NewMatrixNotifierFromEnv},
+		{"email", "SMTP", app.NewEmailNotifierFromEnv},
+		{"ntfy", "NTFY", app.NewNtfyNotifierFromEnv},
+		{"gotify", "GOTIFY", app.NewGotifyNotifierFromEnv},
+		{"webhook", "NOTIFY_WEBHOOK", app.NewJSONWebhookNotifierFromEnv},
+	} {
+		notifier, err := n.new()
+		if err != nil {
+			slog.Warn(n.name+" notifications disabled", "error", err)
+			continue
+		}
+		if notifier == nil {
+			continue
+		}
+		route := app.NotifyRoute{Notifier: notifier, Events: defaultEvents, MinSeverity: defaultMinSeverity}
+		if v, ok := os.LookupEnv(n.prefix + "_EVENTS"); ok {
+			if route.Events, err = app.ParseEvents(v); err != nil {
+				slog.Warn(n.name+" notifications disabled", "error", fmt.Errorf("%s_EVENTS: %w", n.prefix, err))
+				continue
+			}
+		}
+		if v, ok := os.LookupEnv(n.prefix + "_MIN_SEVERITY"); ok {
+			if route.MinSeverity, err = app.ParseSeverity(v); err != nil {
+				slog.Warn(n.name+" notifications disabled", "error", fmt.Errorf("%s_MIN_SEVERITY: %w", n.prefix, err))
+				continue
+			}
+		}
+		cfg.Notifiers = append(cfg.Notifiers, route)
+		slog.Info(n.name+" notifications enabled", "events", route.Events, "min_severity", route.MinSeverity)
+	}
 
-	if notify, err := app.NewTelegramNotifierFromEnv(); err != nil {
-		slog.Warn("telegram notifications disabled", "error", err)
-	} else if notify != nil {
-		cfg.Notify = notify
-		slog.Info("telegram notifications enabled")
+	app.Run(ctx, abortCtx, cli, auths, cfg)
+}
+
+// runSelfHandoff is the entrypoint of the short-lived helper container used to
+// replace an updater that publishes ports.
+func runSelfHandoff(args []string) int {
+	app.SetupLogging(slog.LevelInfo)
+	if len(args) != 2 {
+		slog.Error("self-handoff: expected old and new container IDs")
+		return 2
+	}
+	cli, err := client.New(client.FromEnv)
+	if err != nil {
+		slog.Error("docker client", "error", err)
+		return 1
 	}
+	defer cli.Close()
 
-	app.Run(ctx, cli, auths, cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if err := app.SelfHandoff(ctx, cli, args[0], args[1]); err != nil {
+		slog.Error("self-handoff", "error", err)
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,222 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devem-tech/up-to-date/internal/statefile"
+)
+
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
+// Approval is a detected update of a container that waits for an operator.
+type Approval struct {
+	Container string    `json:"container"`
+	Image     string    `json:"image"`
+	Current   string    `json:"current"`
+	Target    string    `json:"target"`
+	Requested time.Time `json:"requested"`
+	Expires   time.Time `json:"expires"`
+	Status    string    `json:"status"`
+}
+
+func (a Approval) expired(now time.Time) bool {
+	return !a.Expires.IsZero() && now.After(a.Expires)
+}
+
+// approvalStore keeps approvals in <state-dir>/approvals.json, shared with the
+// approve/reject subcommands. Without a state dir they live in memory only.
+type approvalStore struct {
+	mu   sync.Mutex
+	path string
+	mem  map[string]Approval
+}
+
+func newApprovalStore(stateDir string) *approvalStore {
+	s := &approvalStore{mem: map[string]Approval{}}
+	if stateDir != "" {
+		s.path = filepath.Join(stateDir, "approvals.json")
+	}
+	return s
+}
+
+// load returns a snapshot of the stored approvals without writing them back.
+func (s *approvalStore) load() (map[string]Approval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadLocked()
+}
+
+// loadLocked returns a copy of the stored approvals; s.mu must be held.
+func (s *approvalStore) loadLocked() (map[string]Approval, error) {
+	if s.path == "" {
+		return maps.Clone(s.mem), nil
+	}
+	m := map[string]Approval{}
+	if err := statefile.Load(s.path, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// update applies fn to the stored approvals. They are saved only when fn
+// reports a change, so that the daemon does not overwrite a decision made by
+// the approve/reject subcommands in the meantime.
+func (s *approvalStore) update(fn func(m map[string]Approval) (bool, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.loadLocked()
+	if err != nil {
+		return err
+	}
+	changed, err := fn(m)
+	if err != nil || !changed {
+		return err
+	}
+	if s.path == "" {
+		s.mem = m
+		return nil
+	}
+	return statefile.Save(s.path, m)
+}
+
+func (s *approvalStore) list() ([]Approval, error) {
+	m, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Approval, 0, len(m))
+	for _, a := range m {
+		out = append(out, a)
+	}
+	slices.SortFunc(out, func(a, b Approval) int { return strings.Compare(a.Container, b.Container) })
+	return out, nil
+}
+
+func (s *approvalStore) decide(name string, approve bool) (Approval, error) {
+	var out Approval
+	err := s.update(func(m map[string]Approval) (bool, error) {
+		a, ok := m[name]
+		if !ok {
+			return false, fmt.Errorf("no pending approval for %q", name)
+		}
+		if a.expired(time.Now()) {
+			return false, fmt.Errorf("approval for %q expired at %s", name, a.Expires.UTC().Format(time.RFC3339))
+		}
+		a.Status = ApprovalRejected
+		if approve {
+			a.Status = ApprovalApproved
+		}
+		m[name] = a
+		out = a
+		return true, nil
+	})
+	return out, err
+}
+
+// gate decides whether plan may be applied. It opens a new request when none
+// exists for the target image, or when the previous one expired. The returned
+// bool is true when the update may proceed.
+func (s *approvalStore) gate(plan *plannedUpdate, ttl time.Duration) (bool, updateResult, error) {
+	var res updateResult
+	var allowed bool
+	now := time.Now()
+	err := s.update(func(m map[string]Approval) (bool, error) {
+		a, ok := m[plan.ref.Name]
+		if ok && a.Target == plan.newImageID && !a.expired(now) {
+			switch a.Status {
+			case ApprovalApproved:
+				allowed = true
+			case ApprovalRejected:
+				res = plan.result(updatePending)
+				res.Reason = "rejected"
+			default:
+				res = plan.result(updatePending)
+				res.Reason = "awaiting approval"
+			}
+			return false, nil
+		}
+
+		m[plan.ref.Name] = Approval{
+			Container: plan.ref.Name,
+			Image:     plan.imageRef,
+			Current:   plan.oldImageID,
+			Target:    plan.newImageID,
+			Requested: now,
+			Expires:   now.Add(ttl),
+			Status:    ApprovalPending,
+		}
+		res = plan.result(updatePending)
+		res.Reason, res.Notify = "awaiting approval", true
+		return true, nil
+	})
+	return allowed, res, err
+}
+
+func (s *approvalStore) remove(name string) error {
+	return s.update(func(m map[string]Approval) (bool, error) {
+		if _, ok := m[name]; !ok {
+			return false, nil
+		}
+		delete(m, name)
+		return true, nil
+	})
+}
+
+// ListApprovals returns the approvals stored in stateDir.
+func ListApprovals(stateDir string) ([]Approval, error) {
+	return newApprovalStore(stateDir).list()
+}
+
+// DecideApproval approves or rejects the pending update of a container.
+func DecideApproval(stateDir, name string, approve bool) (Approval, error) {
+	return newApprovalStore(stateDir).decide(name, approve)
+}
+
+func registerApprovalRoutes(mux *http.ServeMux, secret string, store *approvalStore) {
+	mux.HandleFunc("GET /approvals", func(w http.ResponseWriter, r *http.Request) {
+		if !verifyWebhook(r, nil, secret) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		list, err := store.list()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(list)
+	})
+
+	decide := func(approve bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !verifyWebhook(r, nil, secret) {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			a, err := store.decide(r.PathValue("name"), approve)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			logf(slog.LevelInfo, "approval for %s (%s) %s via http from %s", a.Container, shortID(a.Target), a.Status, r.RemoteAddr)
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(a)
+		}
+	}
+	mux.HandleFunc("POST /approvals/{name}/approve", decide(true))
+	mux.HandleFunc("POST /approvals/{name}/reject", decide(false))
+}
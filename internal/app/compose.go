@@ -0,0 +1,205 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/client"
+)
+
+// labelComposeImage holds the image ID the service was created from; compose
+// recreates the container on `up` when it no longer matches.
+const labelComposeImage = "com.docker.compose.image"
+
+// newContainerConfig returns a copy of the container config pointing at
+// imageRef and labelled with the container it replaces. The compose
+// config-hash label is kept as is, so a later `docker compose up` sees the
+// container as up to date.
+func newContainerConfig(ctx context.Context, cli *client.Client, cur container.InspectResponse, imageRef string) *container.Config {
+	cfg := *cur.Config
+	cfg.Image = imageRef
+	cfg.Labels = maps.Clone(cfg.Labels)
+	if cfg.Labels == nil {
+		cfg.Labels = map[string]string{}
+	}
+	cfg.Labels[labelReplaces] = cur.ID
+	if _, ok := cfg.Labels[labelComposeImage]; ok {
+		if img, err := cli.ImageInspect(ctx, imageRef); err == nil {
+			cfg.Labels[labelComposeImage] = img.ID
+		}
+	}
+	return &cfg
+}
+
+// sessionUnit is a set of containers updated together: one container, or a
+// whole compose project with --compose-groups.
+type sessionUnit struct {
+	project    string
+	containers []container.Summary
+}
+
+func sessionUnits(cfg Config, containers []container.Summary, selfID string) []sessionUnit {
+	units := make([]sessionUnit, 0, len(containers))
+	byProject := map[string]int{}
+	for _, c := range containers {
+		project := c.Labels[labelComposeProject]
+		if !cfg.ComposeGroups || project == "" || c.ID == selfID {
+			units = append(units, sessionUnit{containers: []container.Summary{c}})
+			continue
+		}
+		if i, ok := byProject[project]; ok {
+			units[i].containers = append(units[i].containers, c)
+			continue
+		}
+		byProject[project] = len(units)
+		units = append(units, sessionUnit{project: project, containers: []container.Summary{c}})
+	}
+	return units
+}
+
+// runProject pulls and checks all services of a compose project first, then
+// recreates the changed ones in dependency order. If any of them fails, the
+// services already recreated are rolled back.
+func (r *runner) runProject(ctx context.Context, u sessionUnit, graph depGraph, failedNames map[string]bool, rep *sessionReport, opts checkOptions) {
+	start := time.Now()
+	failProject := func(ref containerRef, res updateResult, err error) {
+		logContainerf(slog.LevelError, ref, "update error: %v", err)
+		rep.addFailure(ref, u.project, res, err, time.Since(start))
+		for _, c := range u.containers {
+			failedNames[containerRefFromSummary(c).Name] = true
+		}
+	}
+
+	// Results of services left as they are only count once the project was
+	// updated; a rollback reports the whole project as failed.
+	type deferredResult struct {
+		ref containerRef
+		res updateResult
+		dur time.Duration
+	}
+	var results []deferredResult
+	var plans []*plannedUpdate
+	planned := map[string]bool{}
+	for _, c := range u.containers {
+		ref := containerRefFromSummary(c)
+		if dep := graph.failedDependency(ref.Name, failedNames); dep != "" {
+			failProject(ref, summaryResult(c), fmt.Errorf("skipped: dependency %s failed", dep))
+			return
+		}
+		if !opts.SkipPull {
+			r.lastChecked[ref.Name] = time.Now()
+		}
+		checkStart := time.Now()
+		plan, res, err := r.checkContainer(ctx, c, opts)
+		if err != nil {
+			failProject(ref, summaryResult(c), err)
+			return
+		}
+		if plan == nil {
+			results = append(results, deferredResult{ref: ref, res: res, dur: time.Since(checkStart)})
+			continue
+		}
+		plans = append(plans, plan)
+		planned[plan.ref.Name] = true
+	}
+	addResults := func() {
+		for _, d := range results {
+			rep.addResult(d.ref, u.project, d.res, d.dur)
+		}
+	}
+	if len(plans) == 0 {
+		addResults()
+		return
+	}
+
+	logf(slog.LevelInfo, "project %s: updating %d service(s)", u.project, len(plans))
+	var replaced []*replacedContainer
+	replacedIDs := map[string]string{}
+	for _, plan := range plans {
+		joinReplacedNetwork(plan, replacedIDs)
+
+		copts := opts
+		copts.Dependents = nil
+		for _, d := range graph.runningDependents(plan.ref.Name) {
+			if !planned[containerRefFromInspect(d).Name] {
+				copts.Dependents = append(copts.Dependents, d)
+			}
+		}
+
+		old, err := r.applyUpdate(ctx, plan, copts, true)
+		if err != nil {
+			r.rollbackProject(ctx, u.project, replaced, plan)
+			failProject(plan.ref, plan.result(updateNone), err)
+			for j, old := range replaced {
+				rep.FailedCount++
+				rep.addRollback(containerRef{Name: old.name}, u.project, plans[j].result(updateNone), fmt.Sprintf("rolled back: %s failed", plan.ref.Name), err)
+			}
+			return
+		}
+		replaced = append(replaced, old)
+		replacedIDs[old.id] = old.name
+	}
+
+	for _, old := range replaced {
+		r.commitReplaced(ctx, old)
+	}
+	addResults()
+	for _, plan := range plans {
+		r.applied(plan)
+		logContainerf(slog.LevelInfo, plan.ref, "updated successfully %s", plan)
+		rep.addResult(plan.ref, u.project, plan.result(updateApplied), time.Since(start))
+	}
+}
+
+// joinReplacedNetwork points a container that shares the network namespace of
+// a service replaced earlier in the group at the new container.
+// The host config is copied, so that the inspected original stays intact.
+func joinReplacedNetwork(plan *plannedUpdate, replacedIDs map[string]string) {
+	if plan.cur.HostConfig == nil || !plan.cur.HostConfig.NetworkMode.IsContainer() {
+		return
+	}
+	joined := plan.cur.HostConfig.NetworkMode.ConnectedContainer()
+	for id, name := range replacedIDs {
+		if joined == name || strings.HasPrefix(id, joined) {
+			hc := *plan.cur.HostConfig
+			hc.NetworkMode = container.NetworkMode("container:" + name)
+			plan.cur.HostConfig = &hc
+			return
+		}
+	}
+}
+
+// rollbackProject restores all old containers first and starts them in
+// dependency order afterwards, since some may join others' namespaces. The
+// service whose update failed was already put back by recreateContainer and
+// is started last.
+func (r *runner) rollbackProject(ctx context.Context, project string, replaced []*replacedContainer, failed *plannedUpdate) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+	if len(replaced) > 0 {
+		logf(slog.LevelWarn, "project %s: rolling back %d service(s)", project, len(replaced))
+	}
+	for i := len(replaced) - 1; i >= 0; i-- {
+		r.rollbackReplaced(ctx, replaced[i], false)
+	}
+	for _, old := range replaced {
+		if old.start {
+			restartOld(ctx, r.cli, old.id, containerRef{Name: old.name, ID: shortID(old.id)})
+		}
+	}
+
+	st := failed.cur.State
+	if st == nil || !st.Running && !st.Restarting {
+		return
+	}
+	ins, err := r.cli.ContainerInspect(ctx, failed.cur.ID, client.ContainerInspectOptions{})
+	if err != nil || shortName(ins.Container.Name) != failed.ref.Name || ins.Container.State == nil || ins.Container.State.Running {
+		return
+	}
+	restartOld(ctx, r.cli, failed.cur.ID, failed.ref)
+}
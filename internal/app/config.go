@@ -11,11 +11,60 @@ type Config struct {
 	LabelEnable bool
 	Label       string
 
+	ExcludeLabels []string
+
+	Scope string
+
+	ComposeGroups bool
+
+	Policy ImagePolicy
+
+	IncludeStopped    bool
+	IncludeRestarting bool
+
+	Names   []string // явно заданные имена контейнеров (позиционные аргументы)
+	Include []Pattern
+	Exclude []Pattern
+
 	DockerConfigPath string // путь до config.json для registry auth (опционально)
 
 	RollingLabel string
 
+	MonitorOnly  bool
+	MonitorLabel string
+	MonitorPull  bool
+
+	MinImageAge time.Duration
+
+	ApprovalLabel string
+	ApprovalTTL   time.Duration
+
+	StateDir string // каталог для состояния между запусками (опционально)
+
+	ShutdownGrace time.Duration
+
+	WatchEvents bool
+
+	WebhookAddr   string
+	WebhookSecret string
+
 	LogLevel slog.Level
 
-	Notify NotifyFunc
+	// Version is reported in startup and shutdown notifications.
+	Version string
+
+	// Host names this instance in notifications.
+	Host      string
+	Notifiers []NotifyRoute
+	// NotifyTransientAfter is how many consecutive transient failures of a
+	// container trigger EventTransient.
+	NotifyTransientAfter int
+	// NotifyDigest holds updates for a digest sent at this interval;
+	// NotifyDigestAt ("15:04") sends it once a day instead.
+	NotifyDigest   time.Duration
+	NotifyDigestAt string
+	// NotifyQueueTTL is how long undelivered notifications are retried.
+	NotifyQueueTTL time.Duration
+	// NotifyTemplate is a text/template or html/template file replacing the built-in message.
+	NotifyTemplate string
 }
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/devem-tech/up-to-date/internal/statefile"
+)
+
+const (
+	labelMinAge = "devem.tech/up-to-date.min-age"
+
+	imageSeenRetention = 30 * 24 * time.Hour
+)
+
+// imageSeenStore remembers when an image ID was first pulled, so that images
+// without a usable Created timestamp can still be aged.
+type imageSeenStore struct {
+	path string
+	seen map[string]time.Time
+}
+
+func loadImageSeenStore(stateDir string) *imageSeenStore {
+	s := &imageSeenStore{seen: map[string]time.Time{}}
+	if stateDir == "" {
+		return s
+	}
+	s.path = filepath.Join(stateDir, "images-seen.json")
+	if err := statefile.Load(s.path, &s.seen); err != nil {
+		logf(slog.LevelWarn, "load %s: %v", s.path, err)
+	}
+	return s
+}
+
+// firstSeen returns when imageID was first seen, recording now if it is new.
+func (s *imageSeenStore) firstSeen(imageID string, now time.Time) (time.Time, bool) {
+	if t, ok := s.seen[imageID]; ok {
+		return t, false
+	}
+	for id, t := range s.seen {
+		if now.Sub(t) > imageSeenRetention {
+			delete(s.seen, id)
+		}
+	}
+	s.seen[imageID] = now
+	if s.path != "" {
+		if err := statefile.Save(s.path, s.seen); err != nil {
+			logf(slog.LevelWarn, "save %s: %v", s.path, err)
+		}
+	}
+	return now, true
+}
+
+func (r *runner) minImageAge(ref containerRef, labels map[string]string) time.Duration {
+	v, ok := labels[labelMinAge]
+	if !ok {
+		return r.cfg.MinImageAge
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil || d < 0 {
+		if r.invalidMinAges[ref.Name] != v {
+			r.invalidMinAges[ref.Name] = v
+			logContainerf(slog.LevelWarn, ref, "invalid %s label %q, using %s", labelMinAge, v, r.cfg.MinImageAge)
+		}
+		return r.cfg.MinImageAge
+	}
+	delete(r.invalidMinAges, ref.Name)
+	return d
+}
+
+// imageCreatedAt prefers the image Created timestamp and falls back to the
+// first-seen time when it is missing or obviously bogus (e.g. reproducible
+// builds that set it to the epoch).
+func imageCreatedAt(created string, firstSeen, now time.Time) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, created)
+	if err != nil || t.Year() < 2000 || t.After(now) {
+		return firstSeen
+	}
+	return t
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"log/slog"
+
+	"github.com/moby/moby/api/types/container"
+)
+
+// dedupeFailures drops failures and rollbacks that were already reported with
+// the same error, and reports containers that failed before and passed this check as
+// recovered.
+func (r *runner) dedupeFailures(rep *sessionReport, checked []container.Summary) {
+	failing := map[string]bool{}
+	failed := rep.Failed[:0]
+	for _, e := range rep.Failed {
+		failing[e.Container] = true
+		if prev, ok := r.reportedFailures[e.Container]; ok && prev.Error == e.Error {
+			logf(slog.LevelDebug, "%s: failure already reported, not notifying again", e.Container)
+			continue
+		}
+		r.reportedFailures[e.Container] = e
+		failed = append(failed, e)
+	}
+	rep.Failed = failed
+
+	for _, e := range rep.transient {
+		failing[e.Container] = true
+	}
+	for _, e := range rep.Transient {
+		r.reportedFailures[e.Container] = e
+	}
+	// A failed update that keeps rolling back would otherwise be reported
+	// as a rollback on every check.
+	rolledBack := rep.RolledBack[:0]
+	for _, e := range rep.RolledBack {
+		failing[e.Container] = true
+		if prev, ok := r.reportedRollbacks[e.Container]; ok && prev == e.Error {
+			logf(slog.LevelDebug, "%s: rollback already reported, not notifying again", e.Container)
+			continue
+		}
+		r.reportedRollbacks[e.Container] = e.Error
+		rolledBack = append(rolledBack, e)
+	}
+	rep.RolledBack = rolledBack
+
+	for _, c := range checked {
+		name := containerRefFromSummary(c).Name
+		if failing[name] {
+			continue
+		}
+		delete(r.reportedRollbacks, name)
+		prev, ok := r.reportedFailures[name]
+		if !ok {
+			continue
+		}
+		delete(r.reportedFailures, name)
+		rep.Recovered = append(rep.Recovered, ReportEntry{Container: name, Project: prev.Project, Reason: prev.Error})
+	}
+}
@@ -0,0 +1,212 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/client"
+)
+
+const (
+	labelComposeProject   = "com.docker.compose.project"
+	labelComposeService   = "com.docker.compose.service"
+	labelComposeDependsOn = "com.docker.compose.depends_on"
+)
+
+// depGraph holds dependencies between all managed containers, keyed by
+// container name.
+type depGraph struct {
+	deps       map[string][]string
+	dependents map[string][]string
+	inspected  map[string]container.InspectResponse
+}
+
+func buildDepGraph(ctx context.Context, cli *client.Client, containers []container.Summary) depGraph {
+	g := depGraph{
+		deps:       map[string][]string{},
+		dependents: map[string][]string{},
+		inspected:  map[string]container.InspectResponse{},
+	}
+
+	idToName := map[string]string{}
+	services := map[[2]string]string{} // {project, service} -> name
+	for _, c := range containers {
+		name := containerRefFromSummary(c).Name
+		ins, err := cli.ContainerInspect(ctx, c.ID, client.ContainerInspectOptions{})
+		if err != nil {
+			logContainerf(slog.LevelDebug, containerRefFromSummary(c), "dependency inspect error: %v", err)
+			continue
+		}
+		g.inspected[name] = ins.Container
+		idToName[c.ID] = name
+		if p, s := c.Labels[labelComposeProject], c.Labels[labelComposeService]; p != "" && s != "" {
+			services[[2]string{p, s}] = name
+		}
+	}
+
+	resolve := func(idOrName string) string {
+		idOrName = strings.TrimPrefix(idOrName, "/")
+		if _, ok := g.inspected[idOrName]; ok {
+			return idOrName
+		}
+		for id, name := range idToName {
+			if len(idOrName) >= 12 && strings.HasPrefix(id, idOrName) {
+				return name
+			}
+		}
+		return ""
+	}
+
+	for name, cur := range g.inspected {
+		var deps []string
+		if hc := cur.HostConfig; hc != nil {
+			if hc.NetworkMode.IsContainer() {
+				deps = append(deps, resolve(hc.NetworkMode.ConnectedContainer()))
+			}
+			for _, l := range hc.Links {
+				src, _, _ := strings.Cut(l, ":")
+				deps = append(deps, resolve(src))
+			}
+			for _, v := range hc.VolumesFrom {
+				src, _, _ := strings.Cut(v, ":")
+				deps = append(deps, resolve(src))
+			}
+		}
+		if cur.Config != nil {
+			project := cur.Config.Labels[labelComposeProject]
+			for _, entry := range strings.Split(cur.Config.Labels[labelComposeDependsOn], ",") {
+				svc, _, _ := strings.Cut(strings.TrimSpace(entry), ":")
+				if svc != "" {
+					deps = append(deps, services[[2]string{project, svc}])
+				}
+			}
+		}
+
+		for _, d := range deps {
+			if d == "" || d == name || slices.Contains(g.deps[name], d) {
+				continue
+			}
+			g.deps[name] = append(g.deps[name], d)
+			g.dependents[d] = append(g.dependents[d], name)
+		}
+	}
+	return g
+}
+
+// order sorts containers so that dependencies come before their dependents.
+// Containers in a cycle keep their original relative order.
+func (g depGraph) order(containers []container.Summary) []container.Summary {
+	byName := map[string]container.Summary{}
+	for _, c := range containers {
+		byName[containerRefFromSummary(c).Name] = c
+	}
+
+	out := make([]container.Summary, 0, len(containers))
+	state := map[string]int{} // 1 visiting, 2 done
+	var visit func(name string)
+	visit = func(name string) {
+		switch state[name] {
+		case 1:
+			logf(slog.LevelWarn, "dependency cycle involving %s", name)
+			return
+		case 2:
+			return
+		}
+		state[name] = 1
+		for _, d := range g.deps[name] {
+			visit(d)
+		}
+		state[name] = 2
+		if c, ok := byName[name]; ok {
+			out = append(out, c)
+		}
+	}
+	for _, c := range containers {
+		visit(containerRefFromSummary(c).Name)
+	}
+	return out
+}
+
+// failedDependency returns the first dependency of name found in failed.
+func (g depGraph) failedDependency(name string, failed map[string]bool) string {
+	for _, d := range g.deps[name] {
+		if failed[d] {
+			return d
+		}
+	}
+	return ""
+}
+
+// runningDependents returns the running containers that depend on name.
+func (g depGraph) runningDependents(name string) []container.InspectResponse {
+	var out []container.InspectResponse
+	for _, d := range g.dependents[name] {
+		cur, ok := g.inspected[d]
+		if ok && cur.State != nil && cur.State.Running {
+			out = append(out, cur)
+		}
+	}
+	return out
+}
+
+func stopDependents(ctx context.Context, cli *client.Client, dependents []container.InspectResponse, prog *progress) {
+	for _, d := range dependents {
+		ref := containerRefFromInspect(d)
+		prog.step(ref, "stopping dependent container")
+		// By name: the dependent may have been recreated since the graph was
+		// built, when it depends on more than one updated container.
+		if _, err := cli.ContainerStop(ctx, ref.Name, client.ContainerStopOptions{}); err != nil {
+			logContainerf(slog.LevelWarn, ref, "stop dependent: %v", err)
+		}
+	}
+}
+
+// restoreDependents brings stopped dependents back after their parent was
+// updated or rolled back. Containers sharing the parent's network namespace
+// have to be recreated, since the namespace they joined is gone.
+func restoreDependents(ctx context.Context, cli *client.Client, parent string, dependents []container.InspectResponse, prog *progress) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+	for _, d := range dependents {
+		ref := containerRefFromInspect(d)
+		ins, err := cli.ContainerInspect(ctx, ref.Name, client.ContainerInspectOptions{})
+		if err != nil {
+			logContainerf(slog.LevelError, ref, "inspect dependent: %v", err)
+			continue
+		}
+		d = ins.Container
+		ref = containerRefFromInspect(d)
+		if d.HostConfig != nil && d.HostConfig.NetworkMode.IsContainer() {
+			joined := d.HostConfig.NetworkMode.ConnectedContainer()
+			ins, err := cli.ContainerInspect(ctx, parent, client.ContainerInspectOptions{})
+			if err == nil && joined != parent && !strings.HasPrefix(ins.Container.ID, joined) {
+				hc := *d.HostConfig
+				hc.NetworkMode = container.NetworkMode("container:" + ins.Container.ID)
+				d.HostConfig = &hc
+				if _, err := recreateContainer(ctx, cli, d, restoreImageRef(ctx, cli, d), recreateOptions{Start: true}, prog); err != nil {
+					logContainerf(slog.LevelError, ref, "recreate dependent: %v", err)
+				}
+				continue
+			}
+		}
+		prog.step(ref, "starting dependent container")
+		if _, err := cli.ContainerStart(ctx, d.ID, client.ContainerStartOptions{}); err != nil {
+			logContainerf(slog.LevelError, ref, "start dependent: %v", err)
+		}
+	}
+	prog.done()
+}
+
+// restoreImageRef returns the image to recreate a dependent from: its image
+// reference while that still resolves to the image it runs, otherwise the
+// image ID, so that restoring it never picks up a newer image.
+func restoreImageRef(ctx context.Context, cli *client.Client, d container.InspectResponse) string {
+	if img, err := cli.ImageInspect(ctx, d.Config.Image); err == nil && img.ID == d.Image {
+		return d.Config.Image
+	}
+	logContainerf(slog.LevelWarn, containerRefFromInspect(d), "%s no longer resolves to %s, recreating from the image ID", d.Config.Image, shortID(d.Image))
+	return d.Image
+}
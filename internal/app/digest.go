@@ -0,0 +1,125 @@
+package app
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// digest holds routine news (updates and new available or pending updates)
+// and sends it as one report every interval or once a day. Failures and
+// everything else are never held.
+type digest struct {
+	every time.Duration
+	// at is the time of day used when every is zero.
+	at time.Duration
+
+	since     time.Time
+	updated   []ReportEntry
+	pending   []ReportEntry
+	available []ReportEntry
+}
+
+// ParseClock parses a "15:04" time of day into the offset from midnight.
+func ParseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, want HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func newDigest(cfg Config) *digest {
+	if cfg.NotifyDigest > 0 {
+		return &digest{every: cfg.NotifyDigest}
+	}
+	if cfg.NotifyDigestAt == "" {
+		return nil
+	}
+	at, err := ParseClock(cfg.NotifyDigestAt)
+	if err != nil {
+		return nil
+	}
+	return &digest{at: at}
+}
+
+// next returns when the digest is due after now.
+func (d *digest) next(now time.Time) time.Time {
+	if d.every > 0 {
+		return now.Add(d.every)
+	}
+	y, m, day := now.Date()
+	t := time.Date(y, m, day, 0, 0, 0, 0, now.Location()).Add(d.at)
+	if !t.After(now) {
+		t = time.Date(y, m, day+1, 0, 0, 0, 0, now.Location()).Add(d.at)
+	}
+	return t
+}
+
+// hold moves the routine parts of report into the digest and returns what
+// is left to be sent right away.
+func (d *digest) hold(report Report) Report {
+	if d.since.IsZero() && (slices.Contains(report.Events, EventUpdated) || slices.Contains(report.Events, EventAvailable)) {
+		d.since = report.StartedAt
+	}
+	if slices.Contains(report.Events, EventUpdated) {
+		d.updated = append(d.updated, report.Updated...)
+		for _, e := range report.Updated {
+			d.pending = removeEntry(d.pending, e.Container)
+			d.available = removeEntry(d.available, e.Container)
+		}
+	}
+	if slices.Contains(report.Events, EventAvailable) {
+		d.pending = mergeEntries(d.pending, report.Pending)
+		d.available = mergeEntries(d.available, report.Available)
+	}
+
+	report.Updated, report.Pending, report.Available = nil, nil, nil
+	report.Events = slices.DeleteFunc(slices.Clone(report.Events), func(e Event) bool {
+		return e == EventUpdated || e == EventAvailable
+	})
+	report.Severity = maxSeverity(report.Events)
+	return report
+}
+
+// flush returns the held report and empties the digest.
+func (d *digest) flush(host string, now time.Time) (Report, bool) {
+	rep := Report{
+		Host:      host,
+		Title:     "digest",
+		StartedAt: d.since,
+		Duration:  now.Sub(d.since),
+		Updated:   d.updated,
+		Pending:   d.pending,
+		Available: d.available,
+	}
+	if len(rep.Updated) > 0 {
+		rep.Events = append(rep.Events, EventUpdated)
+	}
+	if len(rep.Pending) > 0 || len(rep.Available) > 0 {
+		rep.Events = append(rep.Events, EventAvailable)
+	}
+	d.since, d.updated, d.pending, d.available = time.Time{}, nil, nil, nil
+	return rep, len(rep.Events) > 0
+}
+
+// mergeEntries adds entries, replacing older ones of the same container.
+func mergeEntries(held, entries []ReportEntry) []ReportEntry {
+	for _, e := range entries {
+		held = append(removeEntry(held, e.Container), e)
+	}
+	return held
+}
+
+func removeEntry(entries []ReportEntry, name string) []ReportEntry {
+	return slices.DeleteFunc(entries, func(e ReportEntry) bool { return e.Container == name })
+}
+
+func (r *runner) flushDigest() {
+	if r.digest == nil {
+		return
+	}
+	if rep, ok := r.digest.flush(r.cfg.Host, time.Now()); ok {
+		r.notify(rep)
+	}
+}
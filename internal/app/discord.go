@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// discordNotifier posts to a Discord webhook, one embed per report section.
+type discordNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewDiscordNotifierFromEnv() (Notifier, error) {
+	endpoint := strings.TrimSpace(os.Getenv("DISCORD_WEBHOOK_URL"))
+	if endpoint == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("DISCORD_WEBHOOK_URL must be an https URL")
+	}
+
+	return discordNotifier{
+		url:    endpoint,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (n discordNotifier) Name() string { return "discord" }
+
+func (n discordNotifier) Notify(ctx context.Context, report Report) error {
+	body, err := json.Marshal(buildDiscordMessage(report))
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.client, n.url, body, "discord")
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Color       int            `json:"color"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+	Footer      *discordFooter `json:"footer,omitempty"`
+}
+
+type discordFooter struct {
+	Text string `json:"text"`
+}
+
+type discordMessage struct {
+	Username string         `json:"username"`
+	Content  string         `json:"content"`
+	Embeds   []discordEmbed `json:"embeds,omitempty"`
+}
+
+var discordMarkup = listMarkup{
+	// Backticks would end the code span early.
+	escape:  strings.NewReplacer("`", "'").Replace,
+	project: func(s string) string { return "**" + s + "**" },
+	code:    func(s string) string { return "`" + s + "`" },
+	block:   func(s string) string { return "```\n" + s + "\n```" },
+	link:    markdownLink,
+}
+
+// Discord limits an embed description to 4096 characters and all embeds of a
+// message to 6000 together. Sections that no longer get minEmbedDescription
+// characters are left out and counted in the message content.
+const (
+	maxEmbedDescription = 4096
+	maxEmbedsTotal      = 6000
+	minEmbedDescription = 100
+)
+
+func buildDiscordMessage(report Report) discordMessage {
+	if report.Message != "" {
+		// Message content is limited to 2000 characters.
+		return discordMessage{Username: "up-to-date", Content: truncate(report.Message, 2000)}
+	}
+	msg := discordMessage{Username: "up-to-date", Content: "**" + reportHeader(report) + "**"}
+	footer := fmt.Sprintf("%d scanned · %d failed", report.Scanned, report.FailedCount)
+	budget := maxEmbedsTotal
+	sections := reportSections(report)
+	for i, sec := range sections {
+		room := min(maxEmbedDescription, budget-len(sec.title)-len(footer))
+		if room < minEmbedDescription {
+			msg.Content += fmt.Sprintf("\n%d more section(s) left out, the message is too long", len(sections)-i)
+			break
+		}
+		var b strings.Builder
+		writeRefList(&b, sec, discordMarkup)
+		e := discordEmbed{
+			Title:       sec.title,
+			Description: truncate(strings.TrimPrefix(b.String(), "\n"), room),
+			Color:       sec.color,
+			Footer:      &discordFooter{Text: footer},
+		}
+		budget -= len(e.Title) + len(e.Description) + len(footer)
+		if !report.StartedAt.IsZero() {
+			e.Timestamp = report.StartedAt.UTC().Format(time.RFC3339)
+		}
+		msg.Embeds = append(msg.Embeds, e)
+	}
+	return msg
+}
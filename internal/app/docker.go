@@ -3,6 +3,7 @@ package app
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"strings"
 
 	"github.com/moby/moby/api/types/container"
@@ -17,13 +18,77 @@ func listTargetContainers(ctx context.Context, cli *client.Client, cfg Config) (
 	}
 
 	res, err := cli.ContainerList(ctx, client.ContainerListOptions{
-		All:     false,
+		All:     cfg.IncludeStopped,
 		Filters: f,
 	})
 	if err != nil {
 		return nil, err
 	}
-	return res.Items, nil
+
+	out := make([]container.Summary, 0, len(res.Items))
+	for _, c := range res.Items {
+		if !isManagedState(cfg, c.State) {
+			continue
+		}
+		if !isTargetSummary(cfg, c) {
+			logContainerf(slog.LevelDebug, containerRefFromSummary(c), "excluded by selection")
+			continue
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func listContainersByID(ctx context.Context, cli *client.Client, cfg Config, ids []string) ([]container.Summary, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	res, err := cli.ContainerList(ctx, client.ContainerListOptions{
+		All:     cfg.IncludeStopped,
+		Filters: make(client.Filters).Add("id", ids...),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]container.Summary, 0, len(res.Items))
+	for _, c := range res.Items {
+		if isManagedState(cfg, c.State) && isTargetSummary(cfg, c) {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func isManagedState(cfg Config, state container.ContainerState) bool {
+	switch state {
+	case container.StateRunning, container.StatePaused:
+		return true
+	case container.StateRestarting:
+		return cfg.IncludeRestarting
+	case container.StateCreated, container.StateExited:
+		return cfg.IncludeStopped
+	}
+	return false
+}
+
+func listContainersByImage(ctx context.Context, cli *client.Client, cfg Config, imageRefs []string) ([]container.Summary, error) {
+	want := map[string]bool{}
+	for _, ref := range imageRefs {
+		want[normalizeImageRef(ref)] = true
+	}
+
+	containers, err := listTargetContainers(ctx, cli, cfg)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]container.Summary, 0, len(containers))
+	for _, c := range containers {
+		if want[normalizeImageRef(c.Image)] {
+			out = append(out, c)
+		}
+	}
+	return out, nil
 }
 
 func buildNetworkingConfig(cur container.InspectResponse) *network.NetworkingConfig {
@@ -53,6 +118,36 @@ func pullImage(ctx context.Context, cli *client.Client, ref, registryAuth string
 	return resp.Wait(ctx)
 }
 
+// remoteDigestIfChanged asks the registry for the manifest digest of ref and
+// returns it when the local image does not carry it. Images without repo
+// digests (e.g. built locally) are never reported.
+func remoteDigestIfChanged(ctx context.Context, cli *client.Client, ref, registryAuth, localImageID string) (string, error) {
+	dist, err := cli.DistributionInspect(ctx, ref, client.DistributionInspectOptions{
+		EncodedRegistryAuth: registryAuth,
+	})
+	if err != nil {
+		return "", err
+	}
+	digest := string(dist.Descriptor.Digest)
+	if digest == "" || localImageID == "" {
+		return "", nil
+	}
+
+	img, err := cli.ImageInspect(ctx, localImageID)
+	if err != nil {
+		return "", fmt.Errorf("inspect local image: %w", err)
+	}
+	if len(img.RepoDigests) == 0 {
+		return "", nil
+	}
+	for _, rd := range img.RepoDigests {
+		if strings.HasSuffix(rd, "@"+digest) {
+			return "", nil
+		}
+	}
+	return digest, nil
+}
+
 func cleanupOldImageIfUnused(ctx context.Context, cli *client.Client, oldImageID string) (bool, string, error) {
 	oldImageID = strings.TrimSpace(oldImageID)
 	if oldImageID == "" {
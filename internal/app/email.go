@@ -0,0 +1,223 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// emailNotifier sends the report as a multipart (plain text and HTML) email.
+type emailNotifier struct {
+	host     string
+	port     string
+	security string // starttls, tls or none
+	username string
+	password string
+	from     *mail.Address
+	to       []*mail.Address
+}
+
+func NewEmailNotifierFromEnv() (Notifier, error) {
+	host := strings.TrimSpace(os.Getenv("SMTP_HOST"))
+	if host == "" {
+		return nil, nil
+	}
+	port := strings.TrimSpace(os.Getenv("SMTP_PORT"))
+	if port == "" {
+		port = "587"
+	}
+	security := strings.ToLower(strings.TrimSpace(os.Getenv("SMTP_SECURITY")))
+	switch security {
+	case "":
+		security = "starttls"
+		if port == "465" {
+			security = "tls"
+		}
+	case "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("SMTP_SECURITY must be starttls, tls or none")
+	}
+
+	from, err := mail.ParseAddress(os.Getenv("SMTP_FROM"))
+	if err != nil {
+		return nil, fmt.Errorf("SMTP_FROM: %w", err)
+	}
+	to, err := mail.ParseAddressList(os.Getenv("SMTP_TO"))
+	if err != nil {
+		return nil, fmt.Errorf("SMTP_TO: %w", err)
+	}
+	username := os.Getenv("SMTP_USERNAME")
+	// net/smtp refuses to send credentials in the clear to anything but localhost.
+	if security == "none" && username != "" && !isLocalhost(host) {
+		return nil, fmt.Errorf("SMTP_USERNAME needs SMTP_SECURITY starttls or tls unless SMTP_HOST is localhost")
+	}
+
+	return emailNotifier{
+		host:     host,
+		port:     port,
+		security: security,
+		username: username,
+		password: os.Getenv("SMTP_PASSWORD"),
+		from:     from,
+		to:       to,
+	}, nil
+}
+
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+func (n emailNotifier) Name() string { return "email" }
+
+func (n emailNotifier) Notify(ctx context.Context, report Report) error {
+	msg, err := n.buildMessage(report)
+	if err != nil {
+		return err
+	}
+	return sendWithRetry(ctx, func() error { return n.send(ctx, msg) })
+}
+
+func (n emailNotifier) send(ctx context.Context, msg []byte) error {
+	addr := net.JoinHostPort(n.host, n.port)
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	tlsConfig := &tls.Config{ServerName: n.host}
+
+	var conn net.Conn
+	var err error
+	if n.security == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	c, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if n.security == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp server %s does not support STARTTLS", addr)
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if n.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.username, n.password, n.host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.from.Address); err != nil {
+		return err
+	}
+	for _, to := range n.to {
+		if err := c.Rcpt(to.Address); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (n emailNotifier) buildMessage(report Report) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	type bodyPart struct {
+		contentType string
+		text        string
+	}
+	parts := []bodyPart{
+		{"text/plain; charset=utf-8", buildPlainMessage(report)},
+		{"text/html; charset=utf-8", buildEmailHTML(report)},
+	}
+	switch {
+	case report.Message != "" && report.messageHTML:
+		parts = []bodyPart{{"text/html; charset=utf-8", report.Message}}
+	case report.Message != "":
+		parts = parts[:1]
+	}
+	for _, part := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.text)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	to := make([]string, 0, len(n.to))
+	for _, a := range n.to {
+		to = append(to, a.String())
+	}
+	var msg bytes.Buffer
+	for _, h := range [][2]string{
+		{"From", n.from.String()},
+		{"To", strings.Join(to, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", reportSummary(report))},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", fmt.Sprintf("<up-to-date.%d@%s>", time.Now().UnixNano(), n.host)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + mw.Boundary()},
+	} {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h[0], h[1])
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+func buildEmailHTML(report Report) string {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html><html><body style="font-family: sans-serif">`)
+	fmt.Fprintf(&b, "<h2>%s</h2>", html.EscapeString(reportHeader(report)))
+	for _, sec := range reportSections(report) {
+		fmt.Fprintf(&b, "<h3>%s</h3>", sec.title)
+		var list strings.Builder
+		writeRefList(&list, sec, htmlMarkup)
+		// pre-line keeps the line breaks of the list but lets <pre> blocks alone.
+		fmt.Fprintf(&b, `<div style="white-space: pre-line">%s</div>`, strings.TrimPrefix(list.String(), "\n"))
+	}
+	fmt.Fprintf(&b, `<p style="color: #888">%d scanned · %d failed · %s</p>`,
+		report.Scanned, report.FailedCount, report.Duration.Round(time.Second))
+	b.WriteString("</body></html>")
+	return b.String()
+}
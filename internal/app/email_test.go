@@ -0,0 +1,189 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// smtpSession is what the stand-in server received.
+type smtpSession struct {
+	auth string
+	from string
+	rcpt []string
+	data []byte
+}
+
+// serveSMTP accepts one connection on ln and speaks just enough SMTP for
+// net/smtp: EHLO, AUTH PLAIN, MAIL, RCPT, DATA and QUIT.
+func serveSMTP(t *testing.T, ln net.Listener) <-chan smtpSession {
+	t.Helper()
+	done := make(chan smtpSession, 1)
+	go func() {
+		var s smtpSession
+		defer func() { done <- s }()
+
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		reply := func(line string) { _ = tp.PrintfLine("%s", line) }
+
+		reply("220 localhost ESMTP stand-in")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO", "HELO":
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			case "AUTH":
+				s.auth = strings.TrimPrefix(arg, "PLAIN ")
+				reply("235 2.7.0 authenticated")
+			case "MAIL":
+				s.from = arg
+				reply("250 2.1.0 ok")
+			case "RCPT":
+				s.rcpt = append(s.rcpt, arg)
+				reply("250 2.1.5 ok")
+			case "DATA":
+				reply("354 go ahead")
+				s.data, err = tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				reply("250 2.0.0 queued")
+			case "QUIT":
+				reply("221 2.0.0 bye")
+				return
+			default:
+				reply("502 5.5.2 not implemented")
+			}
+		}
+	}()
+	return done
+}
+
+func TestEmailNotifierSendsMultipartMessage(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := serveSMTP(t, ln)
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	t.Setenv("SMTP_HOST", host)
+	t.Setenv("SMTP_PORT", port)
+	t.Setenv("SMTP_SECURITY", "none")
+	t.Setenv("SMTP_USERNAME", "alerts")
+	t.Setenv("SMTP_PASSWORD", "secret")
+	t.Setenv("SMTP_FROM", "up-to-date <alerts@example.org>")
+	t.Setenv("SMTP_TO", "ops@example.org, Dev Team <dev@example.org>")
+	n, err := NewEmailNotifierFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := Report{
+		Host:    "web-1",
+		Scanned: 3,
+		Updated: []ReportEntry{{Container: "nginx", Image: "nginx:1.27", NewImageID: "sha256:0123456789abcdef"}},
+		Failed:  []ReportEntry{{Container: "api", Image: "ghcr.io/org/api:2", Error: "pull: denied"}},
+	}
+	report.FailedCount = len(report.Failed)
+	if err := n.Notify(context.Background(), report); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	s := <-received
+
+	// Envelope.
+	if s.from != "FROM:<alerts@example.org>" {
+		t.Errorf("MAIL %q", s.from)
+	}
+	if want := []string{"TO:<ops@example.org>", "TO:<dev@example.org>"}; strings.Join(s.rcpt, ",") != strings.Join(want, ",") {
+		t.Errorf("RCPT %q, want %q", s.rcpt, want)
+	}
+	if auth, _ := base64.StdEncoding.DecodeString(s.auth); string(auth) != "\x00alerts\x00secret" {
+		t.Errorf("AUTH PLAIN %q", auth)
+	}
+
+	// Headers.
+	msg, err := mail.ReadMessage(strings.NewReader(string(s.data)))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	if got := msg.Header.Get("From"); got != `"up-to-date" <alerts@example.org>` {
+		t.Errorf("From %q", got)
+	}
+	if got := msg.Header.Get("To"); got != `<ops@example.org>, "Dev Team" <dev@example.org>` {
+		t.Errorf("To %q", got)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Up-to-date · web-1: 1 updated, 1 failed" {
+		t.Errorf("Subject %q (%v)", subject, err)
+	}
+	for _, h := range []string{"Date", "Message-Id"} {
+		if msg.Header.Get(h) == "" {
+			t.Errorf("missing %s header", h)
+		}
+	}
+
+	// Body: a plain text and an HTML alternative.
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type %q (%v)", mediaType, err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	wantParts := []struct {
+		contentType string
+		contains    []string
+	}{
+		{"text/plain; charset=utf-8", []string{"Up-to-date · web-1", "• nginx – 0123456789ab", "• api", "pull: denied"}},
+		{"text/html; charset=utf-8", []string{"<h2>Up-to-date · web-1</h2>", "<code>nginx</code>", "<pre>pull: denied</pre>"}},
+	}
+	for _, want := range wantParts {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("next part: %v", err)
+		}
+		if got := part.Header.Get("Content-Type"); got != want.contentType {
+			t.Errorf("part Content-Type %q, want %q", got, want.contentType)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		for _, s := range want.contains {
+			if !strings.Contains(string(body), s) {
+				t.Errorf("%s part lacks %q:\n%s", want.contentType, s, body)
+			}
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("expected two parts, got more (%v)", err)
+	}
+}
+
+func TestEmailNotifierRejectsPlainAuthWithoutTLS(t *testing.T) {
+	t.Setenv("SMTP_HOST", "smtp.example.org")
+	t.Setenv("SMTP_SECURITY", "none")
+	t.Setenv("SMTP_USERNAME", "alerts")
+	t.Setenv("SMTP_FROM", "alerts@example.org")
+	t.Setenv("SMTP_TO", "ops@example.org")
+	if _, err := NewEmailNotifierFromEnv(); err == nil {
+		t.Fatal("expected an error for credentials over an unencrypted connection")
+	}
+}
@@ -3,10 +3,18 @@ package app
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"strings"
 )
 
+// errRolledBack marks update errors after which the old container was put back.
+var errRolledBack = errors.New("rolled back")
+
+func rolledBack(err error) error {
+	return fmt.Errorf("%w; %w", err, errRolledBack)
+}
+
 func isTransientError(err error) bool {
 	if err == nil {
 		return false
@@ -0,0 +1,217 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moby/moby/api/types/events"
+	"github.com/moby/moby/client"
+)
+
+const (
+	eventsReconnectDelay = 5 * time.Second
+	eventsCheckCooldown  = time.Minute
+	// ownPullWindow is how long after its own pull of a ref the updater
+	// ignores pull events for it.
+	ownPullWindow = time.Minute
+)
+
+type checkRequest struct {
+	IDs       []string
+	ImageRefs []string
+	Reason    string
+	SkipPull  bool
+	// Cooldown skips containers that were pulled for within eventsCheckCooldown.
+	Cooldown bool
+}
+
+type inventoryItem struct {
+	Name     string
+	ImageRef string
+}
+
+// inventory holds managed running containers keyed by ID. It is owned by the
+// events watcher goroutine.
+type inventory map[string]inventoryItem
+
+func (inv inventory) idsByImage(imageRef string) []string {
+	imageRef = normalizeImageRef(imageRef)
+	var ids []string
+	for id, item := range inv {
+		if item.ImageRef == imageRef {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// ownPulls remembers the refs the runner pulled itself, so that the pull
+// events they cause do not trigger another check. It is shared by the runner
+// and the events watcher.
+type ownPulls struct {
+	mu sync.Mutex
+	at map[string]time.Time
+}
+
+func newOwnPulls() *ownPulls {
+	return &ownPulls{at: map[string]time.Time{}}
+}
+
+// mark records a pull of imageRef by the runner. It is called both before and
+// after the pull, since the event may arrive before the pull call returns.
+func (p *ownPulls) mark(imageRef string, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ref, at := range p.at {
+		if now.Sub(at) > ownPullWindow {
+			delete(p.at, ref)
+		}
+	}
+	p.at[normalizeImageRef(imageRef)] = now
+}
+
+// recent reports whether the runner pulled imageRef within ownPullWindow.
+func (p *ownPulls) recent(imageRef string, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	at, ok := p.at[normalizeImageRef(imageRef)]
+	return ok && now.Sub(at) <= ownPullWindow
+}
+
+func watchEvents(ctx context.Context, cli *client.Client, cfg Config, pulls *ownPulls, triggers chan<- checkRequest) {
+	for {
+		if err := watchEventsOnce(ctx, cli, cfg, pulls, triggers); err != nil && ctx.Err() == nil {
+			logf(slog.LevelWarn, "docker events stream error: %v (reconnecting in %s)", err, eventsReconnectDelay)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventsReconnectDelay):
+		}
+	}
+}
+
+func watchEventsOnce(ctx context.Context, cli *client.Client, cfg Config, pulls *ownPulls, triggers chan<- checkRequest) error {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	f := make(client.Filters).
+		Add("type", string(events.ContainerEventType), string(events.ImageEventType)).
+		Add("event",
+			string(events.ActionCreate),
+			string(events.ActionStart),
+			string(events.ActionDestroy),
+			string(events.ActionTag),
+			string(events.ActionPull),
+		)
+	stream := cli.Events(streamCtx, client.EventsListOptions{Filters: f})
+
+	// Seed after subscribing so that nothing started in between is missed.
+	containers, err := listTargetContainers(ctx, cli, cfg)
+	if err != nil {
+		return err
+	}
+	inv := inventory{}
+	for _, c := range containers {
+		inv[c.ID] = inventoryItem{
+			Name:     containerRefFromSummary(c).Name,
+			ImageRef: normalizeImageRef(c.Image),
+		}
+	}
+	logf(slog.LevelDebug, "docker events: watching %d container(s)", len(inv))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-stream.Err:
+			return err
+		case msg := <-stream.Messages:
+			if req, ok := inv.apply(cfg, pulls, msg); ok {
+				select {
+				case triggers <- req:
+				default:
+					logf(slog.LevelDebug, "docker events: check queue full, dropping %s", req.Reason)
+				}
+			}
+		}
+	}
+}
+
+func (inv inventory) apply(cfg Config, pulls *ownPulls, msg events.Message) (checkRequest, bool) {
+	switch msg.Type {
+	case events.ContainerEventType:
+		return inv.applyContainerEvent(cfg, msg)
+	case events.ImageEventType:
+		return inv.applyImageEvent(pulls, msg)
+	}
+	return checkRequest{}, false
+}
+
+func (inv inventory) applyContainerEvent(cfg Config, msg events.Message) (checkRequest, bool) {
+	id := msg.Actor.ID
+	attrs := msg.Actor.Attributes
+	name := shortName(attrs["name"])
+
+	switch msg.Action {
+	case events.ActionDestroy:
+		if _, ok := inv[id]; ok {
+			delete(inv, id)
+			logf(slog.LevelDebug, "docker events: %s removed from inventory", name)
+		}
+		return checkRequest{}, false
+	case events.ActionCreate:
+		// Labels are fixed at create time; a relabelled container is a new one.
+		if !isTargetContainer(cfg, name, attrs["image"], attrs) {
+			delete(inv, id)
+		}
+		return checkRequest{}, false
+	case events.ActionStart:
+		if !isTargetContainer(cfg, name, attrs["image"], attrs) {
+			delete(inv, id)
+			return checkRequest{}, false
+		}
+		inv[id] = inventoryItem{Name: name, ImageRef: normalizeImageRef(attrs["image"])}
+		return checkRequest{
+			IDs:      []string{id},
+			Reason:   "container " + name + " started",
+			Cooldown: true,
+		}, true
+	}
+	return checkRequest{}, false
+}
+
+func (inv inventory) applyImageEvent(pulls *ownPulls, msg events.Message) (checkRequest, bool) {
+	var imageRef string
+	switch msg.Action {
+	case events.ActionPull:
+		imageRef = msg.Actor.ID
+	case events.ActionTag:
+		imageRef = msg.Actor.Attributes["name"]
+	default:
+		return checkRequest{}, false
+	}
+	imageRef = strings.TrimSpace(imageRef)
+	if imageRef == "" {
+		return checkRequest{}, false
+	}
+	if msg.Action == events.ActionPull && pulls.recent(imageRef, time.Now()) {
+		logf(slog.LevelDebug, "docker events: ignoring own pull of %s", imageRef)
+		return checkRequest{}, false
+	}
+
+	ids := inv.idsByImage(imageRef)
+	if len(ids) == 0 {
+		return checkRequest{}, false
+	}
+	// The image is already local, so only compare IDs; pulling again would
+	// emit another pull event.
+	return checkRequest{
+		IDs:      ids,
+		Reason:   "image " + imageRef + " " + string(msg.Action),
+		SkipPull: true,
+	}, true
+}
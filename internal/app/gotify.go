@@ -0,0 +1,115 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// gotifyNotifier pushes a markdown message through a Gotify application.
+type gotifyNotifier struct {
+	endpoint string
+	token    string
+	tags     []string
+	click    string
+	client   *http.Client
+}
+
+func NewGotifyNotifierFromEnv() (Notifier, error) {
+	server := strings.TrimRight(strings.TrimSpace(os.Getenv("GOTIFY_URL")), "/")
+	if server == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(server); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("GOTIFY_URL must be an http(s) URL")
+	}
+	token := strings.TrimSpace(os.Getenv("GOTIFY_TOKEN"))
+	if token == "" {
+		return nil, fmt.Errorf("GOTIFY_URL set but app token is missing")
+	}
+
+	return gotifyNotifier{
+		endpoint: server + "/message",
+		token:    token,
+		tags:     splitList(os.Getenv("GOTIFY_TAGS")),
+		click:    strings.TrimSpace(os.Getenv("GOTIFY_CLICK")),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (n gotifyNotifier) Name() string { return "gotify" }
+
+type gotifyMessage struct {
+	Title    string         `json:"title"`
+	Message  string         `json:"message"`
+	Priority int            `json:"priority"`
+	Extras   map[string]any `json:"extras,omitempty"`
+}
+
+var gotifyMarkup = listMarkup{
+	escape:  func(s string) string { return strings.ReplaceAll(s, "`", "'") },
+	project: func(s string) string { return "**" + s + "**" },
+	code:    func(s string) string { return "`" + s + "`" },
+	block:   func(s string) string { return "```\n" + s + "\n```" },
+	link:    markdownLink,
+}
+
+func (n gotifyNotifier) Notify(ctx context.Context, report Report) error {
+	var b strings.Builder
+	contentType := "text/markdown"
+	if report.Message != "" {
+		b.WriteString(report.Message)
+		contentType = "text/plain"
+	} else {
+		for _, sec := range reportSections(report) {
+			if b.Len() > 0 {
+				b.WriteString("\n\n")
+			}
+			b.WriteString("**" + sec.title + "**\n")
+			writeRefList(&b, sec, gotifyMarkup)
+		}
+	}
+	if len(n.tags) > 0 {
+		// Gotify has no tags of its own, so they end the message as hashtags.
+		b.WriteString("\n\n#" + strings.Join(n.tags, " #"))
+	}
+
+	priority := 5
+	switch report.Severity {
+	case SeverityWarning:
+		priority = 6
+	case SeverityError:
+		priority = 8
+	}
+	extras := map[string]any{
+		"client::display": map[string]string{"contentType": contentType},
+	}
+	if n.click != "" {
+		extras["client::notification"] = map[string]any{"click": map[string]string{"url": n.click}}
+	}
+	body, err := json.Marshal(gotifyMessage{
+		Title:    reportSummary(report),
+		Message:  b.String(),
+		Priority: priority,
+		Extras:   extras,
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendWithRetry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Gotify-Key", n.token)
+		return doNotifyRequest(n.client, req, "gotify")
+	})
+}
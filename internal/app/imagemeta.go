@@ -0,0 +1,143 @@
+package app
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/moby/moby/client"
+)
+
+// OCI annotation labels, see
+// https://github.com/opencontainers/image-spec/blob/main/annotations.md
+const (
+	labelOCIVersion  = "org.opencontainers.image.version"
+	labelOCIRevision = "org.opencontainers.image.revision"
+	labelOCISource   = "org.opencontainers.image.source"
+	labelOCICreated  = "org.opencontainers.image.created"
+)
+
+// ImageMeta is the OCI metadata of an image, as far as its labels tell.
+type ImageMeta struct {
+	Version  string `json:"version,omitempty"`
+	Revision string `json:"revision,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Created  string `json:"created,omitempty"`
+}
+
+func imageMetaFromLabels(labels map[string]string) ImageMeta {
+	return ImageMeta{
+		Version:  strings.TrimSpace(labels[labelOCIVersion]),
+		Revision: strings.TrimSpace(labels[labelOCIRevision]),
+		Source:   strings.TrimSpace(labels[labelOCISource]),
+		Created:  strings.TrimSpace(labels[labelOCICreated]),
+	}
+}
+
+// inspectImageMeta returns the metadata of a local image; a missing image
+// just has none.
+func inspectImageMeta(ctx context.Context, cli *client.Client, id string) ImageMeta {
+	if id == "" {
+		return ImageMeta{}
+	}
+	img, err := cli.ImageInspect(ctx, id)
+	if err != nil || img.Config == nil {
+		return ImageMeta{}
+	}
+	return imageMetaFromLabels(img.Config.Labels)
+}
+
+// versionChange returns "1.4.2 → 1.5.0", or just the new version if the old
+// one is unknown.
+func versionChange(prev, next ImageMeta) string {
+	switch {
+	case next.Version == "":
+		return ""
+	case prev.Version == "" || prev.Version == next.Version:
+		return next.Version
+	default:
+		return prev.Version + " → " + next.Version
+	}
+}
+
+// revisionRange returns the commit range "abc1234..def5678" between two images.
+func revisionRange(prev, next ImageMeta) string {
+	if prev.Revision == "" || next.Revision == "" || prev.Revision == next.Revision {
+		return ""
+	}
+	return shortRevision(prev.Revision) + ".." + shortRevision(next.Revision)
+}
+
+func shortRevision(rev string) string {
+	if len(rev) > 7 {
+		return rev[:7]
+	}
+	return rev
+}
+
+func describeChange(prev, next ImageMeta) string {
+	var parts []string
+	if v := versionChange(prev, next); v != "" {
+		parts = append(parts, v)
+	}
+	if r := revisionRange(prev, next); r != "" {
+		parts = append(parts, r)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// compareURL links to the source repository's compare view of the two
+// revisions, for the forges whose URL scheme is known.
+func compareURL(prev, next ImageMeta) string {
+	if revisionRange(prev, next) == "" {
+		return ""
+	}
+	src := next.Source
+	if src == "" {
+		src = prev.Source
+	}
+	repo := repoURL(src)
+	if repo == nil {
+		return ""
+	}
+	from, to := url.PathEscape(prev.Revision), url.PathEscape(next.Revision)
+	switch host := repo.Host; {
+	case host == "github.com", host == "codeberg.org", strings.Contains(host, "gitea"), strings.Contains(host, "forgejo"):
+		return repo.String() + "/compare/" + from + "..." + to
+	case host == "gitlab.com", strings.Contains(host, "gitlab"):
+		return repo.String() + "/-/compare/" + from + "..." + to
+	case host == "bitbucket.org":
+		return repo.String() + "/branches/compare/" + to + "%0D" + from
+	}
+	return ""
+}
+
+// repoURL normalizes a source label such as "git@github.com:org/repo.git"
+// or "https://github.com/org/repo/tree/main" to "https://github.com/org/repo".
+func repoURL(src string) *url.URL {
+	src = strings.TrimSpace(src)
+	if rest, ok := strings.CutPrefix(src, "git@"); ok {
+		host, path, found := strings.Cut(rest, ":")
+		if !found {
+			return nil
+		}
+		src = "https://" + host + "/" + path
+	}
+	u, err := url.Parse(src)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 {
+		return nil
+	}
+	// GitLab groups may be nested; everything before "/-/" belongs to the project.
+	if i := slices.Index(parts, "-"); i >= 2 {
+		parts = parts[:i]
+	} else if !strings.Contains(u.Host, "gitlab") {
+		parts = parts[:2]
+	}
+	parts[len(parts)-1] = strings.TrimSuffix(parts[len(parts)-1], ".git")
+	return &url.URL{Scheme: "https", Host: u.Host, Path: "/" + strings.Join(parts, "/")}
+}
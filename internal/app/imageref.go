@@ -0,0 +1,16 @@
+package app
+
+import (
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+func normalizeImageRef(ref string) string {
+	ref = strings.TrimSpace(ref)
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return ref
+	}
+	return reference.TagNameOnly(named).String()
+}
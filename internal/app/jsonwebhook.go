@@ -0,0 +1,63 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// jsonWebhookNotifier posts the report as JSON. With a secret, the body is
+// signed in X-Signature-256 as sha256=<hex HMAC>.
+type jsonWebhookNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewJSONWebhookNotifierFromEnv() (Notifier, error) {
+	endpoint := strings.TrimSpace(os.Getenv("NOTIFY_WEBHOOK_URL"))
+	if endpoint == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("NOTIFY_WEBHOOK_URL must be an http(s) URL")
+	}
+
+	return jsonWebhookNotifier{
+		url:    endpoint,
+		secret: strings.TrimSpace(os.Getenv("NOTIFY_WEBHOOK_SECRET")),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (n jsonWebhookNotifier) Name() string { return "webhook" }
+
+func (n jsonWebhookNotifier) Notify(ctx context.Context, report Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	return sendWithRetry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if n.secret != "" {
+			mac := hmac.New(sha256.New, []byte(n.secret))
+			mac.Write(body)
+			req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+		return doNotifyRequest(n.client, req, "webhook")
+	})
+}
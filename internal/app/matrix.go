@@ -0,0 +1,93 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// matrixNotifier sends an m.notice with an HTML body to a Matrix room.
+type matrixNotifier struct {
+	homeserver string
+	token      string
+	roomID     string
+	client     *http.Client
+}
+
+func NewMatrixNotifierFromEnv() (Notifier, error) {
+	homeserver := strings.TrimRight(strings.TrimSpace(os.Getenv("MATRIX_HOMESERVER")), "/")
+	if homeserver == "" {
+		return nil, nil
+	}
+	token := strings.TrimSpace(os.Getenv("MATRIX_ACCESS_TOKEN"))
+	roomID := strings.TrimSpace(os.Getenv("MATRIX_ROOM_ID"))
+	if token == "" || roomID == "" {
+		return nil, fmt.Errorf("MATRIX_HOMESERVER set but access token or room id is missing")
+	}
+	if u, err := url.Parse(homeserver); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("MATRIX_HOMESERVER must be an http(s) URL")
+	}
+
+	return matrixNotifier{
+		homeserver: homeserver,
+		token:      token,
+		roomID:     roomID,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (n matrixNotifier) Name() string { return "matrix" }
+
+func (n matrixNotifier) Notify(ctx context.Context, report Report) error {
+	body, err := json.Marshal(map[string]string{
+		"msgtype":        "m.notice",
+		"body":           buildPlainMessage(report),
+		"format":         "org.matrix.custom.html",
+		"formatted_body": htmlLineBreaks(buildNotificationMessage(report)),
+	})
+	if err != nil {
+		return err
+	}
+
+	// The same transaction ID on every attempt lets the server drop duplicates.
+	txnID := fmt.Sprintf("up-to-date-%d", time.Now().UnixNano())
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		n.homeserver, url.PathEscape(n.roomID), txnID)
+	return sendWithRetry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+n.token)
+		return doNotifyRequest(n.client, req, "matrix")
+	})
+}
+
+// htmlLineBreaks turns newlines into <br> outside <pre> blocks, which keep
+// their newlines.
+func htmlLineBreaks(s string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "<pre>")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(s[start:], "</pre>")
+		if end < 0 {
+			break
+		}
+		end += start + len("</pre>")
+		b.WriteString(strings.ReplaceAll(s[:start], "\n", "<br>"))
+		b.WriteString(s[start:end])
+		s = s[end:]
+	}
+	b.WriteString(strings.ReplaceAll(s, "\n", "<br>"))
+	return b.String()
+}
@@ -1,73 +1,408 @@
 package app
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
-	"net/url"
-	"os"
+	"slices"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/avast/retry-go/v5"
 )
 
-type NotifyFunc func(ctx context.Context, msg string) error
+// Notifier delivers session reports to one destination.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, report Report) error
+}
+
+// Report is the outcome of one session or targeted check.
+type Report struct {
+	Host      string        `json:"host"`
+	Title     string        `json:"title"`
+	Events    []Event       `json:"events"`
+	Severity  Severity      `json:"severity"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"-"`
+	Scanned   int           `json:"scanned"`
+	// FailedCount also counts transient failures, which are not listed in Failed.
+	FailedCount int `json:"failed_count"`
+
+	Updated   []ReportEntry `json:"updated"`
+	Pending   []ReportEntry `json:"pending"`
+	Available []ReportEntry `json:"available"`
+	Skipped   []ReportEntry `json:"skipped"`
+	Failed    []ReportEntry `json:"failed"`
+	// Transient lists containers whose transient failures reached the threshold.
+	Transient  []ReportEntry `json:"transient"`
+	RolledBack []ReportEntry `json:"rolled_back"`
+	// Recovered lists containers whose reported failure is resolved; Reason
+	// holds the former error.
+	Recovered []ReportEntry `json:"recovered"`
+	// Notice is a report-level text: the session error, or startup and shutdown.
+	Notice string `json:"notice,omitempty"`
 
-type telegramNotifier struct {
-	token  string
-	chatID string
-	client *http.Client
+	// Message is the output of --notify-template; notifiers send it instead
+	// of their built-in format when set.
+	Message     string `json:"message,omitempty"`
+	messageHTML bool
 }
 
-func NewTelegramNotifierFromEnv() (NotifyFunc, error) {
-	token := strings.TrimSpace(os.Getenv("TELEGRAM_API_TOKEN"))
-	if token == "" {
-		return nil, nil
+func (r Report) MarshalJSON() ([]byte, error) {
+	type alias Report
+	// Empty lists are sent as [] rather than null.
+	for _, l := range []*[]ReportEntry{&r.Updated, &r.Pending, &r.Available, &r.Skipped, &r.Failed, &r.Transient, &r.RolledBack, &r.Recovered} {
+		if *l == nil {
+			*l = []ReportEntry{}
+		}
 	}
-	chatID := strings.TrimSpace(os.Getenv("TELEGRAM_CHAT_ID"))
-	if chatID == "" {
-		return nil, fmt.Errorf("TELEGRAM_API_TOKEN set but chat id is missing")
+	return json.Marshal(struct {
+		alias
+		DurationSeconds float64 `json:"duration_seconds"`
+	}{alias(r), r.Duration.Seconds()})
+}
+
+// UnmarshalJSON restores Duration, so that queued reports survive a restart.
+func (r *Report) UnmarshalJSON(b []byte) error {
+	type alias Report
+	v := struct {
+		*alias
+		DurationSeconds float64 `json:"duration_seconds"`
+	}{alias: (*alias)(r)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
 	}
+	r.Duration = time.Duration(v.DurationSeconds * float64(time.Second))
+	return nil
+}
+
+// ReportEntry describes what happened to one container.
+type ReportEntry struct {
+	Container  string `json:"container"`
+	Project    string `json:"project,omitempty"`
+	Image      string `json:"image,omitempty"`
+	OldImageID string `json:"old_image_id,omitempty"`
+	NewImageID string `json:"new_image_id,omitempty"`
+	// Old and New hold the OCI labels of both images; CompareURL links to the
+	// source repository's diff between their revisions.
+	Old        ImageMeta     `json:"old,omitzero"`
+	New        ImageMeta     `json:"new,omitzero"`
+	CompareURL string        `json:"compare_url,omitempty"`
+	Reason     string        `json:"reason,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"-"`
+}
 
-	n := telegramNotifier{
-		token:  token,
-		chatID: chatID,
-		client: &http.Client{Timeout: 10 * time.Second},
+func (e ReportEntry) MarshalJSON() ([]byte, error) {
+	type alias ReportEntry
+	return json.Marshal(struct {
+		alias
+		DurationSeconds float64 `json:"duration_seconds"`
+	}{alias(e), e.Duration.Seconds()})
+}
+
+func (e *ReportEntry) UnmarshalJSON(b []byte) error {
+	type alias ReportEntry
+	v := struct {
+		*alias
+		DurationSeconds float64 `json:"duration_seconds"`
+	}{alias: (*alias)(e)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
 	}
-	return n.Notify, nil
+	e.Duration = time.Duration(v.DurationSeconds * float64(time.Second))
+	return nil
 }
 
-func (n telegramNotifier) Notify(ctx context.Context, msg string) error {
-	form := url.Values{}
-	form.Set("chat_id", n.chatID)
-	form.Set("text", msg)
-	form.Set("parse_mode", "HTML")
+func sendWithRetry(ctx context.Context, send func() error) error {
+	return retry.New(
+		retry.Attempts(3),
+		retry.Delay(300*time.Millisecond),
+		retry.Context(ctx),
+	).Do(send)
+}
 
-	endpoint := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", n.token)
-	send := func() error {
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+func postJSON(ctx context.Context, client *http.Client, endpoint string, body []byte, service string) error {
+	return sendWithRetry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
 		if err != nil {
 			return err
 		}
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Content-Type", "application/json")
+		return doNotifyRequest(client, req, service)
+	})
+}
 
-		resp, err := n.client.Do(req)
-		if err != nil {
-			return err
+// statusError is a non-2xx response of a notification service.
+type statusError struct {
+	service string
+	code    int
+	status  string
+	body    string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s status %s: %s", e.service, e.status, e.body)
+}
+
+// permanent reports whether repeating the request cannot help: a client error
+// other than 429.
+func (e *statusError) permanent() bool {
+	return e.code/100 == 4 && e.code != http.StatusTooManyRequests
+}
+
+// permanentNotifyError reports whether the last attempt of a delivery was
+// rejected permanently.
+func permanentNotifyError(err error) bool {
+	var attempts retry.Error
+	if errors.As(err, &attempts) {
+		err = attempts.LastError()
+	}
+	var se *statusError
+	return errors.As(err, &se) && se.permanent()
+}
+
+// doNotifyRequest sends req and turns a non-2xx response into a statusError.
+// Client errors other than 429 are not retried.
+func doNotifyRequest(client *http.Client, req *http.Request, service string) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	se := &statusError{service: service, code: resp.StatusCode, status: resp.Status, body: strings.TrimSpace(string(body))}
+	if se.permanent() {
+		return retry.Unrecoverable(se)
+	}
+	return se
+}
+
+// reportSection is one titled list of a report, shared by all renderers.
+type reportSection struct {
+	title   string
+	entries []ReportEntry
+	info    func(ReportEntry) string
+	// failed sections show info as a block, separated by blank lines.
+	failed bool
+	color  int
+	// text stands in for entries in report-level sections.
+	text string
+}
+
+func reportSections(report Report) []reportSection {
+	var out []reportSection
+	if report.Notice != "" {
+		sec := reportSection{title: "ℹ️ Notice", text: report.Notice, color: 0x95a5a6}
+		switch {
+		case slices.Contains(report.Events, EventSessionError):
+			sec.title, sec.color = "❌ Session error", 0xe74c3c
+		case slices.Contains(report.Events, EventStartup):
+			sec.title = "▶️ Started"
+		case slices.Contains(report.Events, EventShutdown):
+			sec.title = "⏹ Stopped"
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode/100 == 2 {
-			return nil
+		out = append(out, sec)
+	}
+	for _, sec := range []reportSection{
+		{title: "✅ Updated", entries: report.Updated, info: entryImageInfo, color: 0x2ecc71},
+		{title: "⏳ Update pending", entries: report.Pending, info: entryPendingInfo, color: 0xf1c40f},
+		{title: "🔔 Update available", entries: report.Available, info: entryImageInfo, color: 0x3498db},
+		{title: "❌ Failed", entries: report.Failed, info: entryErrorInfo, failed: true, color: 0xe74c3c},
+		{title: "↩️ Rolled back", entries: report.RolledBack, info: entryReasonInfo, color: 0xe67e22},
+		{title: "⚠️ Failing repeatedly", entries: report.Transient, info: entryErrorInfo, failed: true, color: 0xe67e22},
+		{title: "💚 Recovered", entries: report.Recovered, color: 0x2ecc71, info: func(ReportEntry) string { return "" }},
+	} {
+		if len(sec.entries) > 0 {
+			out = append(out, sec)
 		}
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return fmt.Errorf("telegram status %s: %s", resp.Status, strings.TrimSpace(string(body)))
 	}
+	return out
+}
 
-	return retry.New(
-		retry.Attempts(3),
-		retry.Delay(300*time.Millisecond),
-		retry.Context(ctx),
-	).Do(send)
+func entryImageInfo(e ReportEntry) string {
+	if e.Reason != "" && e.NewImageID == "" {
+		return e.Reason
+	}
+	info := shortID(e.NewImageID)
+	if info == "" {
+		info = "unknown"
+	}
+	if v := versionChange(e.Old, e.New); v != "" {
+		return v + " (" + info + ")"
+	}
+	return info
+}
+
+func entryPendingInfo(e ReportEntry) string {
+	return entryImageInfo(e) + ", " + e.Reason
+}
+
+func entryErrorInfo(e ReportEntry) string {
+	return e.Error
+}
+
+func entryReasonInfo(e ReportEntry) string {
+	return e.Reason
+}
+
+func reportHeader(report Report) string {
+	if report.Host == "" {
+		return "Up-to-date"
+	}
+	return "Up-to-date · " + report.Host
+}
+
+// reportSummary is a one-line title such as "Up-to-date · host: 2 updated, 1 failed".
+// Reports without entries, such as startup or a session error, are summarized
+// by the first line of their notice.
+func reportSummary(report Report) string {
+	var parts []string
+	for _, c := range []struct {
+		n    int
+		word string
+	}{
+		{len(report.Updated), "updated"},
+		{len(report.Pending), "pending"},
+		{len(report.Available), "available"},
+		{len(report.Failed), "failed"},
+		{len(report.RolledBack), "rolled back"},
+		{len(report.Transient), "failing repeatedly"},
+		{len(report.Recovered), "recovered"},
+	} {
+		if c.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", c.n, c.word))
+		}
+	}
+	summary := strings.Join(parts, ", ")
+	if summary == "" {
+		summary, _, _ = strings.Cut(strings.TrimSpace(report.Notice), "\n")
+		if len([]rune(summary)) > reportSummaryMaxNotice {
+			summary = string([]rune(summary)[:reportSummaryMaxNotice-1]) + "…"
+		}
+	}
+	if summary == "" && len(report.Events) > 0 {
+		summary = string(report.Events[0])
+	}
+	if summary == "" {
+		return reportHeader(report)
+	}
+	return reportHeader(report) + ": " + summary
+}
+
+// reportSummaryMaxNotice bounds the notice part of a summary, in characters.
+const reportSummaryMaxNotice = 100
+
+// listMarkup adapts writeRefList to the formatting of one platform.
+type listMarkup struct {
+	escape  func(string) string
+	project func(string) string
+	code    func(string) string
+	block   func(string) string
+	// link gets the escaped text and the raw URL.
+	link func(text, url string) string
+}
+
+var plainMarkup = listMarkup{
+	escape:  func(s string) string { return s },
+	project: func(s string) string { return s },
+	code:    func(s string) string { return s },
+	block:   func(s string) string { return "  " + strings.ReplaceAll(s, "\n", "\n  ") },
+	link:    func(text, url string) string { return text + " " + url },
+}
+
+// markdownLink is the link format of Discord and Gotify.
+func markdownLink(text, url string) string {
+	return "[" + text + "](" + url + ")"
+}
+
+func buildPlainMessage(report Report) string {
+	if report.Message != "" {
+		return report.Message
+	}
+	var b strings.Builder
+	b.WriteString(reportHeader(report))
+	for _, sec := range reportSections(report) {
+		b.WriteString("\n\n" + sec.title + ":")
+		writeRefList(&b, sec, plainMarkup)
+	}
+	return b.String()
+}
+
+func writeRefList(b *strings.Builder, sec reportSection, m listMarkup) {
+	// Containers without a compose project first, then one block per project.
+	entries := slices.Clone(sec.entries)
+	slices.SortStableFunc(entries, func(a, b ReportEntry) int { return strings.Compare(a.Project, b.Project) })
+	if sec.text != "" {
+		b.WriteString("\n" + m.escape(sec.text))
+	}
+	project := ""
+	for i, e := range entries {
+		if i > 0 && sec.failed {
+			b.WriteString("\n")
+		}
+		if e.Project != "" && e.Project != project {
+			b.WriteString("\n" + m.project(m.escape(e.Project)))
+		}
+		project = e.Project
+		name := e.Container
+		if name == "" {
+			name = "<noname>"
+		}
+		b.WriteString("\n• " + m.code(m.escape(name)))
+		if text := strings.TrimSpace(sec.info(e)); text != "" {
+			text = m.escape(text)
+			if sec.failed {
+				b.WriteString("\n" + m.block(text))
+			} else {
+				b.WriteString(" – " + m.code(text))
+			}
+		}
+		if rng := revisionRange(e.Old, e.New); rng != "" {
+			if e.CompareURL != "" {
+				b.WriteString(" " + m.link(m.escape(rng), e.CompareURL))
+			} else {
+				b.WriteString(" " + m.code(m.escape(rng)))
+			}
+		}
+	}
+}
+
+// splitList splits a comma-separated environment value.
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// mimeWord encodes s for an HTTP header if it is not plain ASCII.
+func mimeWord(s string) string {
+	return mime.QEncoding.Encode("utf-8", s)
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	const more = "\n…"
+	cut := n - len(more)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + more
 }
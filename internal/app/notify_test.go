@@ -0,0 +1,53 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReportSummary(t *testing.T) {
+	entry := []ReportEntry{{Container: "web"}}
+	tests := []struct {
+		name   string
+		report Report
+		want   string
+	}{
+		{
+			name:   "counts",
+			report: Report{Host: "web-1", Updated: entry, Failed: append(entry, entry...)},
+			want:   "Up-to-date · web-1: 1 updated, 2 failed",
+		},
+		{
+			name:   "rollback, transient and recovered",
+			report: Report{RolledBack: entry, Transient: entry, Recovered: entry},
+			want:   "Up-to-date: 1 rolled back, 1 failing repeatedly, 1 recovered",
+		},
+		{
+			name:   "notice first line",
+			report: Report{Host: "web-1", Notice: "list containers: daemon unreachable\nretrying", Events: []Event{EventSessionError}},
+			want:   "Up-to-date · web-1: list containers: daemon unreachable",
+		},
+		{
+			name:   "long notice",
+			report: Report{Notice: strings.Repeat("x", 150)},
+			want:   "Up-to-date: " + strings.Repeat("x", reportSummaryMaxNotice-1) + "…",
+		},
+		{
+			name:   "event only",
+			report: Report{Events: []Event{EventShutdown}},
+			want:   "Up-to-date: shutdown",
+		},
+		{
+			name:   "empty",
+			report: Report{Host: "web-1"},
+			want:   "Up-to-date · web-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reportSummary(tt.report); got != tt.want {
+				t.Errorf("reportSummary = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
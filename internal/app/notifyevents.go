@@ -0,0 +1,192 @@
+package app
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Event is something a notifier can be subscribed to.
+type Event string
+
+const (
+	EventAvailable    Event = "available" // new pending or available update
+	EventUpdated      Event = "updated"
+	EventFailed       Event = "failed"
+	EventTransient    Event = "transient" // transient failure repeated N times
+	EventRollback     Event = "rollback"
+	EventRecovered    Event = "recovered" // a reported failure is resolved
+	EventSessionError Event = "session-error"
+	EventStartup      Event = "startup"
+	EventShutdown     Event = "shutdown"
+)
+
+var allEvents = []Event{
+	EventAvailable, EventUpdated, EventFailed, EventTransient,
+	EventRollback, EventRecovered, EventSessionError, EventStartup, EventShutdown,
+}
+
+// DefaultNotifyEvents keeps the behaviour from before events were configurable.
+const DefaultNotifyEvents = "available,updated,failed,rollback,recovered"
+
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+var severityNames = []string{"info", "warning", "error"}
+
+func (s Severity) String() string {
+	if int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(b []byte) error {
+	v, err := ParseSeverity(string(b))
+	if err != nil {
+		return err
+	}
+	*s = v
+	return nil
+}
+
+func ParseSeverity(s string) (Severity, error) {
+	i := slices.Index(severityNames, strings.ToLower(strings.TrimSpace(s)))
+	if i < 0 {
+		return 0, fmt.Errorf("unknown severity %q (want info, warning or error)", s)
+	}
+	return Severity(i), nil
+}
+
+func (e Event) Severity() Severity {
+	switch e {
+	case EventFailed, EventSessionError:
+		return SeverityError
+	case EventTransient, EventRollback:
+		return SeverityWarning
+	default:
+		return SeverityInfo
+	}
+}
+
+// ParseEvents parses a comma-separated event list; "all" selects every event.
+func ParseEvents(s string) ([]Event, error) {
+	var out []Event
+	for _, v := range splitList(s) {
+		if v == "all" {
+			return slices.Clone(allEvents), nil
+		}
+		if !slices.Contains(allEvents, Event(v)) {
+			return nil, fmt.Errorf("unknown event %q", v)
+		}
+		out = append(out, Event(v))
+	}
+	return out, nil
+}
+
+// NotifyRoute sends the events of at least MinSeverity to Notifier.
+type NotifyRoute struct {
+	Notifier    Notifier
+	Events      []Event
+	MinSeverity Severity
+}
+
+func (rt NotifyRoute) wants(e Event) bool {
+	return e.Severity() >= rt.MinSeverity && slices.Contains(rt.Events, e)
+}
+
+// filter returns report reduced to the events rt wants, or false if none is left.
+func (rt NotifyRoute) filter(report Report) (Report, bool) {
+	var events []Event
+	for _, e := range report.Events {
+		if rt.wants(e) {
+			events = append(events, e)
+		}
+	}
+	if len(events) == 0 {
+		return Report{}, false
+	}
+	out := report
+	out.Events = events
+	out.Severity = maxSeverity(events)
+	if !rt.wants(EventUpdated) {
+		out.Updated = nil
+	}
+	if !rt.wants(EventAvailable) {
+		out.Pending, out.Available = nil, nil
+	}
+	if !rt.wants(EventFailed) {
+		out.Failed = nil
+	}
+	if !rt.wants(EventTransient) {
+		out.Transient = nil
+	}
+	if !rt.wants(EventRollback) {
+		out.RolledBack = nil
+	}
+	if !rt.wants(EventRecovered) {
+		out.Recovered = nil
+	}
+	return out, true
+}
+
+func maxSeverity(events []Event) Severity {
+	s := SeverityInfo
+	for _, e := range events {
+		s = max(s, e.Severity())
+	}
+	return s
+}
+
+// notify queues report for every route that wants one of its events; the
+// queue worker delivers it right away.
+func (r *runner) notify(report Report) {
+	now := time.Now()
+	for _, rt := range r.cfg.Notifiers {
+		rep, ok := rt.filter(report)
+		if !ok {
+			continue
+		}
+		r.template.render(&rep)
+		r.notifyQueue.push(rt.Notifier, rep, now)
+	}
+}
+
+// deliver sends report now, or holds its routine parts for the digest.
+func (r *runner) deliver(report Report) {
+	if r.digest != nil {
+		report = r.digest.hold(report)
+	}
+	if len(report.Events) > 0 {
+		r.notify(report)
+	}
+}
+
+// notifyOnShutdown flushes the digest, reports the shutdown and gives the
+// queue worker a last chance to deliver.
+func (r *runner) notifyOnShutdown(stopQueue func(time.Duration)) {
+	r.flushDigest()
+	r.notifyLifecycle(EventShutdown, "up-to-date "+r.cfg.Version+" stopped")
+	stopQueue(notifyQueueStopTimeout)
+}
+
+func (r *runner) notifyLifecycle(e Event, text string) {
+	r.notify(Report{
+		Host:      r.cfg.Host,
+		Title:     string(e),
+		StartedAt: time.Now(),
+		Events:    []Event{e},
+		Severity:  e.Severity(),
+		Notice:    text,
+	})
+}
@@ -0,0 +1,305 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/devem-tech/up-to-date/internal/statefile"
+)
+
+const (
+	notifyQueueMaxItems    = 500
+	notifyQueueRetryEvery  = 30 * time.Second
+	notifyQueueBaseBackoff = 30 * time.Second
+	notifyQueueMaxBackoff  = 30 * time.Minute
+	// notifyQueueStopTimeout bounds the last delivery attempt on shutdown.
+	notifyQueueStopTimeout = 30 * time.Second
+)
+
+// multiTargetNotifier is a Notifier that sends every report to several
+// independent targets, such as Telegram chats. The queue keeps one item per
+// target, so that a failure only repeats the delivery to that target.
+type multiTargetNotifier interface {
+	Notifier
+	targets() []string
+	// notifyTarget sends report to target, skipping the first skip messages
+	// of it, which arrived in an earlier attempt. It returns how many of the
+	// messages have arrived by now.
+	notifyTarget(ctx context.Context, target string, report Report, skip int) (int, error)
+}
+
+// queuedNotification is a report waiting to be delivered to one notifier.
+type queuedNotification struct {
+	Notifier string `json:"notifier"`
+	// Target is set for a multiTargetNotifier.
+	Target string `json:"target,omitempty"`
+	// Sent counts the messages of a multi-message report that arrived.
+	Sent   int    `json:"sent,omitempty"`
+	Report Report `json:"report"`
+	// MessageHTML keeps Report.messageHTML, which is not part of its JSON.
+	MessageHTML bool      `json:"message_html,omitempty"`
+	Created     time.Time `json:"created"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+
+	// id tells items apart while one is being delivered.
+	id uint64
+}
+
+func (it queuedNotification) String() string {
+	name := it.Notifier
+	if it.Target != "" {
+		name += " " + it.Target
+	}
+	return name + " message from " + it.Created.Format(time.RFC3339)
+}
+
+// notifyQueue holds outgoing notifications until they are delivered or
+// expire. With a state dir it survives restarts. Items are added by the
+// runner and delivered by the worker started with startNotifyQueue.
+type notifyQueue struct {
+	mu     sync.Mutex
+	path   string
+	ttl    time.Duration
+	items  []queuedNotification
+	nextID uint64
+	// wake asks the worker to deliver newly queued items.
+	wake chan struct{}
+}
+
+func loadNotifyQueue(stateDir string, ttl time.Duration) *notifyQueue {
+	q := &notifyQueue{ttl: ttl, wake: make(chan struct{}, 1)}
+	if stateDir == "" {
+		return q
+	}
+	q.path = filepath.Join(stateDir, "notify-queue.json")
+	if err := statefile.Load(q.path, &q.items); err != nil {
+		logf(slog.LevelWarn, "load %s: %v", q.path, err)
+	}
+	for i := range q.items {
+		q.items[i].Report.messageHTML = q.items[i].MessageHTML
+		q.nextID++
+		q.items[i].id = q.nextID
+	}
+	if len(q.items) > 0 {
+		logf(slog.LevelInfo, "notify queue: %d message(s) left from last run", len(q.items))
+	}
+	return q
+}
+
+// saveLocked writes the queue to disk; q.mu must be held.
+func (q *notifyQueue) saveLocked() {
+	if q.path == "" {
+		return
+	}
+	if err := statefile.Save(q.path, q.items); err != nil {
+		logf(slog.LevelWarn, "save %s: %v", q.path, err)
+	}
+}
+
+// push queues report for n, once per target of a multiTargetNotifier, and
+// wakes the worker.
+func (q *notifyQueue) push(n Notifier, report Report, now time.Time) {
+	targets := []string{""}
+	if mt, ok := n.(multiTargetNotifier); ok {
+		targets = mt.targets()
+	}
+
+	q.mu.Lock()
+	for _, target := range targets {
+		if len(q.items) >= notifyQueueMaxItems {
+			logf(slog.LevelWarn, "notify queue full, dropping %s", q.items[0])
+			q.items = q.items[1:]
+		}
+		q.nextID++
+		q.items = append(q.items, queuedNotification{
+			Notifier:    n.Name(),
+			Target:      target,
+			Report:      report,
+			MessageHTML: report.messageHTML,
+			Created:     now,
+			NextAttempt: now,
+			id:          q.nextID,
+		})
+	}
+	q.saveLocked()
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// due drops expired items and items whose notifier or target is no longer
+// configured, and returns copies of the items to deliver now.
+func (q *notifyQueue) due(notifiers map[string]Notifier, now time.Time) []queuedNotification {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	changed := false
+	q.items = slices.DeleteFunc(q.items, func(it queuedNotification) bool {
+		switch {
+		case !configuredTarget(notifiers[it.Notifier], it.Target):
+			logf(slog.LevelWarn, "notify queue: dropping %s, its notifier is not configured", it)
+		case q.ttl > 0 && now.Sub(it.Created) > q.ttl:
+			logf(slog.LevelWarn, "notify queue: dropping %s after %d attempt(s): %s", it, it.Attempts, it.LastError)
+		default:
+			return false
+		}
+		changed = true
+		return true
+	})
+	if changed {
+		q.saveLocked()
+	}
+
+	var due []queuedNotification
+	for _, it := range q.items {
+		if !it.NextAttempt.After(now) {
+			due = append(due, it)
+		}
+	}
+	return due
+}
+
+func configuredTarget(n Notifier, target string) bool {
+	if n == nil {
+		return false
+	}
+	mt, ok := n.(multiTargetNotifier)
+	if !ok || target == "" {
+		// Items queued without a target go to all targets.
+		return target == ""
+	}
+	return slices.Contains(mt.targets(), target)
+}
+
+// finish records the outcome of delivering it. Items rejected permanently,
+// such as with a 4xx response, are dropped, since repeating the same request
+// cannot succeed.
+func (q *notifyQueue) finish(it queuedNotification, sent int, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := slices.IndexFunc(q.items, func(c queuedNotification) bool { return c.id == it.id })
+	if i < 0 {
+		// Dropped from a full queue meanwhile.
+		return
+	}
+	switch {
+	case err == nil:
+		if it.Attempts > 0 {
+			logf(slog.LevelInfo, "notify queue: delivered %s", it)
+		}
+		q.items = slices.Delete(q.items, i, i+1)
+	case permanentNotifyError(err):
+		logf(slog.LevelError, "%s notify error, dropping %s: %v", it.Notifier, it, err)
+		q.items = slices.Delete(q.items, i, i+1)
+	default:
+		c := &q.items[i]
+		c.Sent = sent
+		c.Attempts++
+		c.LastError = err.Error()
+		c.NextAttempt = time.Now().Add(notifyBackoff(c.Attempts))
+		logf(slog.LevelWarn, "%s notify error (attempt %d, next in %s): %v",
+			c.Notifier, c.Attempts, notifyBackoff(c.Attempts), err)
+	}
+	q.saveLocked()
+}
+
+// pending returns the number of queued items and the creation time of the
+// oldest one.
+func (q *notifyQueue) pending() (int, time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var oldest time.Time
+	for _, it := range q.items {
+		if oldest.IsZero() || it.Created.Before(oldest) {
+			oldest = it.Created
+		}
+	}
+	return len(q.items), oldest
+}
+
+// notifyBackoff doubles the delay with every attempt, up to notifyQueueMaxBackoff.
+func notifyBackoff(attempts int) time.Duration {
+	d := notifyQueueBaseBackoff
+	for i := 1; i < attempts && d < notifyQueueMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, notifyQueueMaxBackoff)
+}
+
+// startNotifyQueue delivers queued notifications in the background, so that
+// an unreachable service holds up neither update checks nor shutdown. The
+// returned function makes a last attempt for the due items, waiting at most
+// timeout, and stops the worker; what is left stays queued for the next run.
+func (r *runner) startNotifyQueue(ctx context.Context) func(timeout time.Duration) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.NewTicker(notifyQueueRetryEvery)
+		defer t.Stop()
+		for {
+			r.flushQueue(ctx)
+			select {
+			case <-stop:
+				r.flushQueue(ctx)
+				return
+			case <-t.C:
+			case <-r.notifyQueue.wake:
+			}
+		}
+	}()
+
+	return func(timeout time.Duration) {
+		defer cancel()
+		close(stop)
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		select {
+		case <-done:
+		case <-t.C:
+			logf(slog.LevelWarn, "notify queue: delivery still running after %s, stopping it", timeout)
+			cancel()
+			<-done
+		}
+	}
+}
+
+// flushQueue tries every due notification once and logs what is left. It
+// runs on the queue worker only.
+func (r *runner) flushQueue(ctx context.Context) {
+	notifiers := map[string]Notifier{}
+	for _, rt := range r.cfg.Notifiers {
+		notifiers[rt.Notifier.Name()] = rt.Notifier
+	}
+
+	q := r.notifyQueue
+	for _, it := range q.due(notifiers, time.Now()) {
+		if ctx.Err() != nil {
+			break
+		}
+		var sent int
+		var err error
+		if mt, ok := notifiers[it.Notifier].(multiTargetNotifier); ok && it.Target != "" {
+			sent, err = mt.notifyTarget(ctx, it.Target, it.Report, it.Sent)
+		} else {
+			err = notifiers[it.Notifier].Notify(ctx, it.Report)
+		}
+		q.finish(it, sent, err)
+	}
+
+	if n, oldest := q.pending(); n > 0 {
+		logf(slog.LevelInfo, "notify queue: %d pending, oldest from %s (%s ago)",
+			n, oldest.Format(time.RFC3339), time.Since(oldest).Round(time.Second))
+	}
+}
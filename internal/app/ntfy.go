@@ -0,0 +1,79 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ntfyNotifier publishes to an ntfy topic, on ntfy.sh or a self-hosted server.
+type ntfyNotifier struct {
+	endpoint string
+	token    string
+	username string
+	password string
+	tags     []string
+	click    string
+	client   *http.Client
+}
+
+func NewNtfyNotifierFromEnv() (Notifier, error) {
+	topic := strings.Trim(strings.TrimSpace(os.Getenv("NTFY_TOPIC")), "/")
+	if topic == "" {
+		return nil, nil
+	}
+	server := strings.TrimRight(strings.TrimSpace(os.Getenv("NTFY_URL")), "/")
+	if server == "" {
+		server = "https://ntfy.sh"
+	}
+	if u, err := url.Parse(server); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("NTFY_URL must be an http(s) URL")
+	}
+
+	return ntfyNotifier{
+		endpoint: server + "/" + url.PathEscape(topic),
+		token:    strings.TrimSpace(os.Getenv("NTFY_TOKEN")),
+		username: os.Getenv("NTFY_USERNAME"),
+		password: os.Getenv("NTFY_PASSWORD"),
+		tags:     splitList(os.Getenv("NTFY_TAGS")),
+		click:    strings.TrimSpace(os.Getenv("NTFY_CLICK")),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (n ntfyNotifier) Name() string { return "ntfy" }
+
+func (n ntfyNotifier) Notify(ctx context.Context, report Report) error {
+	priority, tag := "3", "white_check_mark"
+	switch report.Severity {
+	case SeverityWarning:
+		tag = "warning"
+	case SeverityError:
+		priority, tag = "4", "x"
+	}
+	body := buildPlainMessage(report)
+	return sendWithRetry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.endpoint, strings.NewReader(body))
+		if err != nil {
+			return err
+		}
+		// Header values must be ASCII unless RFC 2047 encoded, which ntfy decodes.
+		req.Header.Set("Title", mimeWord(reportSummary(report)))
+		req.Header.Set("Priority", priority)
+		req.Header.Set("Tags", strings.Join(append([]string{tag}, n.tags...), ","))
+		if n.click != "" {
+			req.Header.Set("Click", n.click)
+		}
+		switch {
+		case n.token != "":
+			req.Header.Set("Authorization", "Bearer "+n.token)
+		case n.username != "":
+			req.SetBasicAuth(n.username, n.password)
+		}
+		return doNotifyRequest(n.client, req, "ntfy")
+	})
+}
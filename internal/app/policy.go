@@ -0,0 +1,103 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+// ImagePolicy restricts which images may be pulled. Patterns may use * to
+// match any sequence of characters, including "/".
+type ImagePolicy struct {
+	AllowRegistries []string
+	AllowImages     []string
+	DenyRegistries  []string
+	DenyImages      []string
+}
+
+func (p ImagePolicy) empty() bool {
+	return len(p.AllowRegistries) == 0 && len(p.AllowImages) == 0 &&
+		len(p.DenyRegistries) == 0 && len(p.DenyImages) == 0
+}
+
+// Validate rejects empty patterns; any other string is a valid wildcard.
+func (p ImagePolicy) Validate() error {
+	for _, list := range [][]string{p.AllowRegistries, p.AllowImages, p.DenyRegistries, p.DenyImages} {
+		for _, pat := range list {
+			if strings.TrimSpace(pat) == "" {
+				return fmt.Errorf("empty pattern")
+			}
+		}
+	}
+	return nil
+}
+
+// evaluate returns whether imageRef may be pulled and the rule that decided it.
+func (p ImagePolicy) evaluate(imageRef string) (bool, string) {
+	if p.empty() {
+		return true, ""
+	}
+	named, err := reference.ParseNormalizedNamed(imageRef)
+	if err != nil {
+		return false, fmt.Sprintf("unparsable image reference: %v", err)
+	}
+	domain := reference.Domain(named)
+	repo := named.Name()
+	full := reference.TagNameOnly(named).String()
+
+	for _, pat := range p.DenyRegistries {
+		if matchRegistryPattern(pat, domain, repo) {
+			return false, "--deny-registry=" + pat
+		}
+	}
+	for _, pat := range p.DenyImages {
+		if matchImagePattern(pat, repo, full) {
+			return false, "--deny-image=" + pat
+		}
+	}
+
+	if len(p.AllowRegistries) == 0 && len(p.AllowImages) == 0 {
+		return true, ""
+	}
+	for _, pat := range p.AllowRegistries {
+		if matchRegistryPattern(pat, domain, repo) {
+			return true, "--allow-registry=" + pat
+		}
+	}
+	for _, pat := range p.AllowImages {
+		if matchImagePattern(pat, repo, full) {
+			return true, "--allow-image=" + pat
+		}
+	}
+	return false, "not matched by any --allow-registry/--allow-image rule"
+}
+
+// matchRegistryPattern matches a registry host such as ghcr.io or
+// *.example.org, or a registry/namespace. Without wildcards a namespace
+// covers everything below it, so ghcr.io/our-org matches ghcr.io/our-org/app.
+func matchRegistryPattern(pat, domain, repo string) bool {
+	pat = strings.TrimSuffix(strings.TrimSpace(pat), "/")
+	if !strings.Contains(pat, "/") {
+		return wildcardMatch(pat, domain)
+	}
+	if !strings.ContainsAny(pat, "*?") {
+		return repo == pat || strings.HasPrefix(repo, pat+"/")
+	}
+	return wildcardMatch(pat, repo)
+}
+
+// matchImagePattern matches a repository (docker.io/library/postgres, or
+// short forms like postgres) or a repository:tag.
+func matchImagePattern(pat, repo, full string) bool {
+	pat = strings.TrimSpace(pat)
+	if !strings.Contains(pat, "*") {
+		if named, err := reference.ParseNormalizedNamed(pat); err == nil {
+			if _, tagged := named.(reference.Tagged); tagged {
+				return named.String() == full
+			}
+			return named.Name() == repo
+		}
+	}
+	return wildcardMatch(pat, repo) || wildcardMatch(pat, full)
+}
@@ -0,0 +1,145 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImagePolicyEvaluate(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   ImagePolicy
+		image    string
+		want     bool
+		wantRule string
+	}{
+		{
+			name:  "empty policy allows everything",
+			image: "nginx:1.27",
+			want:  true,
+		},
+		{
+			name:     "bare registry",
+			policy:   ImagePolicy{AllowRegistries: []string{"ghcr.io"}},
+			image:    "ghcr.io/our-org/app:1",
+			want:     true,
+			wantRule: "--allow-registry=ghcr.io",
+		},
+		{
+			name:     "docker hub short name",
+			policy:   ImagePolicy{AllowRegistries: []string{"docker.io"}},
+			image:    "nginx",
+			want:     true,
+			wantRule: "--allow-registry=docker.io",
+		},
+		{
+			name:     "registry wildcard matches the host only",
+			policy:   ImagePolicy{AllowRegistries: []string{"*.example.org"}},
+			image:    "registry.example.org/team/app:2",
+			want:     true,
+			wantRule: "--allow-registry=*.example.org",
+		},
+		{
+			name:     "registry wildcard does not match a path",
+			policy:   ImagePolicy{AllowRegistries: []string{"*.example.org"}},
+			image:    "ghcr.io/registry.example.org/app",
+			want:     false,
+			wantRule: "not matched by any --allow-registry/--allow-image rule",
+		},
+		{
+			name:     "namespace without wildcard is a prefix",
+			policy:   ImagePolicy{AllowRegistries: []string{"ghcr.io/our-org"}},
+			image:    "ghcr.io/our-org/team/app:1",
+			want:     true,
+			wantRule: "--allow-registry=ghcr.io/our-org",
+		},
+		{
+			name:     "namespace prefix stops at a path separator",
+			policy:   ImagePolicy{AllowRegistries: []string{"ghcr.io/our-org"}},
+			image:    "ghcr.io/our-org-fork/app:1",
+			want:     false,
+			wantRule: "not matched by any --allow-registry/--allow-image rule",
+		},
+		{
+			name:     "namespace with trailing slash",
+			policy:   ImagePolicy{AllowRegistries: []string{"ghcr.io/our-org/"}},
+			image:    "ghcr.io/our-org/app",
+			want:     true,
+			wantRule: "--allow-registry=ghcr.io/our-org/",
+		},
+		{
+			name:     "namespace wildcard",
+			policy:   ImagePolicy{AllowRegistries: []string{"ghcr.io/our-org/*"}},
+			image:    "ghcr.io/our-org/app:1",
+			want:     true,
+			wantRule: "--allow-registry=ghcr.io/our-org/*",
+		},
+		{
+			name:     "short image name",
+			policy:   ImagePolicy{AllowImages: []string{"postgres"}},
+			image:    "docker.io/library/postgres:16",
+			want:     true,
+			wantRule: "--allow-image=postgres",
+		},
+		{
+			name:     "image with tag requires that tag",
+			policy:   ImagePolicy{AllowImages: []string{"postgres:16"}},
+			image:    "postgres:17",
+			want:     false,
+			wantRule: "not matched by any --allow-registry/--allow-image rule",
+		},
+		{
+			name:     "untagged image is latest",
+			policy:   ImagePolicy{AllowImages: []string{"redis:latest"}},
+			image:    "redis",
+			want:     true,
+			wantRule: "--allow-image=redis:latest",
+		},
+		{
+			name:     "image wildcard against repository and tag",
+			policy:   ImagePolicy{AllowImages: []string{"*/library/*:1.*"}},
+			image:    "nginx:1.27",
+			want:     true,
+			wantRule: "--allow-image=*/library/*:1.*",
+		},
+		{
+			name: "deny wins over allow",
+			policy: ImagePolicy{
+				AllowRegistries: []string{"docker.io"},
+				DenyImages:      []string{"docker.io/library/postgres"},
+			},
+			image:    "postgres:16",
+			want:     false,
+			wantRule: "--deny-image=docker.io/library/postgres",
+		},
+		{
+			name:     "deny registry namespace",
+			policy:   ImagePolicy{DenyRegistries: []string{"docker.io/bitnami"}},
+			image:    "bitnami/redis:7",
+			want:     false,
+			wantRule: "--deny-registry=docker.io/bitnami",
+		},
+		{
+			name:     "deny only allows the rest",
+			policy:   ImagePolicy{DenyRegistries: []string{"quay.io"}},
+			image:    "ghcr.io/our-org/app",
+			want:     true,
+			wantRule: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rule := tt.policy.evaluate(tt.image)
+			if got != tt.want || rule != tt.wantRule {
+				t.Errorf("evaluate(%q) = %v, %q; want %v, %q", tt.image, got, rule, tt.want, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestImagePolicyRejectsUnparsableReference(t *testing.T) {
+	p := ImagePolicy{AllowRegistries: []string{"ghcr.io"}}
+	if ok, rule := p.evaluate("Not/Valid"); ok || !strings.HasPrefix(rule, "unparsable image reference: ") {
+		t.Errorf("evaluate = %v, %q", ok, rule)
+	}
+}
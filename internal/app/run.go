@@ -2,21 +2,119 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"html"
 	"log/slog"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/moby/moby/api/types/container"
 	"github.com/moby/moby/client"
 
 	"github.com/devem-tech/up-to-date/internal/dockerauth"
 )
 
-func Run(ctx context.Context, cli *client.Client, auths dockerauth.Index, cfg Config) {
-	opCtx := context.WithoutCancel(ctx)
+type runner struct {
+	cli   *client.Client
+	auths dockerauth.Index
+	cfg   Config
 
-	runOnce(opCtx, cli, auths, cfg)
+	// stopping is closed once shutdown was requested; no new container is
+	// checked after that.
+	stopping <-chan struct{}
+	progress *progress
+
+	lastChecked map[string]time.Time
+	// pulls remembers the runner's own pulls for the events watcher.
+	pulls *ownPulls
+	// invalidIntervals holds the invalid interval label already warned about
+	// per container.
+	invalidIntervals map[string]string
+	// invalidMinAges does the same for the min-age label.
+	invalidMinAges map[string]string
+	imagesSeen     *imageSeenStore
+	// announced holds the target image last reported as available per container.
+	announced map[string]string
+	approvals *approvalStore
+	// transientFailures counts consecutive transient failures per container.
+	transientFailures map[string]int
+	// reportedFailures holds the last failure notified per container.
+	reportedFailures map[string]ReportEntry
+	// reportedRollbacks holds the error of the last rollback notified per container.
+	reportedRollbacks map[string]string
+	lastSessionError  string
+	notifyQueue       *notifyQueue
+	digest            *digest
+	template          *notifyTemplate
+
+	// selfID is the container this updater runs in, if any; selfUpdated names
+	// it after a completed self-update until the next session reports it.
+	selfID      string
+	selfUpdated string
+}
+
+// Run checks containers until ctx is cancelled. The update in flight at that
+// moment may finish within cfg.ShutdownGrace; it is aborted when the grace
+// period ends or abortCtx is cancelled.
+func Run(ctx, abortCtx context.Context, cli *client.Client, auths dockerauth.Index, cfg Config) {
+	opCtx, abortOps := context.WithCancel(context.WithoutCancel(ctx))
+	defer abortOps()
+
+	r := &runner{
+		cli:               cli,
+		auths:             auths,
+		cfg:               cfg,
+		stopping:          ctx.Done(),
+		progress:          &progress{},
+		lastChecked:       map[string]time.Time{},
+		pulls:             newOwnPulls(),
+		invalidIntervals:  map[string]string{},
+		invalidMinAges:    map[string]string{},
+		imagesSeen:        loadImageSeenStore(cfg.StateDir),
+		announced:         map[string]string{},
+		transientFailures: map[string]int{},
+		reportedFailures:  map[string]ReportEntry{},
+		reportedRollbacks: map[string]string{},
+		digest:            newDigest(cfg),
+		notifyQueue:       loadNotifyQueue(cfg.StateDir, cfg.NotifyQueueTTL),
+		approvals:         newApprovalStore(cfg.StateDir),
+		template:          loadNotifyTemplate(cfg.NotifyTemplate),
+	}
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go r.abortAfterGrace(ctx, abortCtx, finished, abortOps)
+
+	var triggers chan checkRequest
+	if cfg.WatchEvents || cfg.WebhookAddr != "" {
+		triggers = make(chan checkRequest, 64)
+	}
+	if cfg.WatchEvents {
+		go watchEvents(ctx, cli, cfg, r.pulls, triggers)
+	}
+	if cfg.WebhookAddr != "" {
+		go serveWebhooks(ctx, cfg, triggers, r.approvals)
+	}
+
+	r.selfID = detectSelfContainerID(opCtx, cli)
+	if r.selfID != "" {
+		logf(slog.LevelDebug, "running in container %s", shortID(r.selfID))
+	}
+	if name, err := completeSelfHandoff(opCtx, cli, r.selfID); err != nil {
+		logf(slog.LevelError, "self-update handoff error: %v", err)
+	} else if name != "" {
+		logf(slog.LevelInfo, "self-update handoff completed")
+		r.selfUpdated = name
+	}
+
+	reconcileInterrupted(opCtx, cli, cfg, r.selfID)
+
+	stopQueue := r.startNotifyQueue(opCtx)
+	r.notifyLifecycle(EventStartup, "up-to-date "+cfg.Version+" started")
+	defer r.notifyOnShutdown(stopQueue)
+
+	r.runOnce(opCtx)
 	if ctx.Err() != nil {
 		logf(slog.LevelInfo, "shutdown")
 		return
@@ -25,115 +123,393 @@ func Run(ctx context.Context, cli *client.Client, auths dockerauth.Index, cfg Co
 	t := time.NewTicker(cfg.Interval)
 	defer t.Stop()
 
+	var digestTimer *time.Timer
+	var digestDue <-chan time.Time
+	if r.digest != nil {
+		digestTimer = time.NewTimer(time.Until(r.digest.next(time.Now())))
+		defer digestTimer.Stop()
+		digestDue = digestTimer.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			logf(slog.LevelInfo, "shutdown")
 			return
 		case <-t.C:
-			runOnce(opCtx, cli, auths, cfg)
-			if ctx.Err() != nil {
-				logf(slog.LevelInfo, "shutdown")
-				return
-			}
+			r.runOnce(opCtx)
+		case req := <-triggers:
+			r.runTargeted(opCtx, req)
+		case <-digestDue:
+			r.flushDigest()
+			digestTimer.Reset(time.Until(r.digest.next(time.Now())))
+		}
+		if ctx.Err() != nil {
+			logf(slog.LevelInfo, "shutdown")
+			return
 		}
 	}
 }
 
-func runOnce(ctx context.Context, cli *client.Client, auths dockerauth.Index, cfg Config) {
-	start := time.Now()
-	containers, err := listTargetContainers(ctx, cli, cfg)
+func (r *runner) abortAfterGrace(ctx, abortCtx context.Context, finished <-chan struct{}, abort context.CancelFunc) {
+	select {
+	case <-finished:
+		return
+	case <-ctx.Done():
+	}
+
+	if inflight := r.progress.String(); inflight != "" {
+		logf(slog.LevelInfo, "shutdown requested, finishing %s (grace %s)", inflight, r.cfg.ShutdownGrace)
+	}
+
+	grace := time.NewTimer(r.cfg.ShutdownGrace)
+	defer grace.Stop()
+
+	var reason string
+	select {
+	case <-finished:
+		return
+	case <-grace.C:
+		reason = "grace period expired"
+	case <-abortCtx.Done():
+		reason = "second signal received"
+	}
+
+	if inflight := r.progress.String(); inflight != "" {
+		logf(slog.LevelWarn, "shutdown: %s, aborting %s; it will be reconciled on next start", reason, inflight)
+	} else {
+		logf(slog.LevelWarn, "shutdown: %s, aborting", reason)
+	}
+	abort()
+}
+
+func (r *runner) stopRequested() bool {
+	select {
+	case <-r.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *runner) runOnce(ctx context.Context) {
+	containers, err := listTargetContainers(ctx, r.cli, r.cfg)
 	if err != nil {
 		logf(slog.LevelError, "list containers error: %v", err)
+		r.notifySessionError(fmt.Errorf("list containers: %w", err))
 		return
 	}
-	scanned := len(containers)
-	updated := 0
-	failed := 0
-	updatedRefs := make([]notifyRef, 0)
-	failedRefs := make([]notifyRef, 0)
-
-	logf(slog.LevelDebug, "scan: %d container(s) eligible", scanned)
+	r.lastSessionError = ""
+	r.runSession(ctx, "session done", containers, r.skipNotDue(containers), checkOptions{})
+}
 
+// skipNotDue drops containers whose interval label asks for checks less
+// often than the base tick and that were checked recently enough.
+func (r *runner) skipNotDue(containers []container.Summary) []container.Summary {
+	now := time.Now()
+	var out []container.Summary
 	for _, c := range containers {
 		ref := containerRefFromSummary(c)
-		wasUpdated, newImageID, err := updateContainerIfNeeded(ctx, cli, auths, cfg, c)
-		if err != nil {
-			logContainerf(slog.LevelError, ref, "update error: %v", err)
-			failed++
-			if !isTransientError(err) {
-				failedRefs = append(failedRefs, notifyRef{Name: ref.Name, Info: err.Error()})
+		interval := r.checkInterval(ref, c.Labels)
+		if last, ok := r.lastChecked[ref.Name]; ok {
+			// Half a tick of slack so that ticker jitter does not push a check
+			// to the next tick.
+			if next := last.Add(interval - r.cfg.Interval/2); now.Before(next) {
+				logContainerf(slog.LevelDebug, ref, "not due until %s", next.UTC().Format(time.RFC3339))
+				continue
 			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func (r *runner) runTargeted(ctx context.Context, req checkRequest) {
+	var containers []container.Summary
+	var err error
+	if len(req.ImageRefs) > 0 {
+		containers, err = listContainersByImage(ctx, r.cli, r.cfg, req.ImageRefs)
+	} else {
+		containers, err = listContainersByID(ctx, r.cli, r.cfg, req.IDs)
+	}
+	if err != nil {
+		logf(slog.LevelError, "list containers error: %v", err)
+		r.notifySessionError(fmt.Errorf("list containers: %w", err))
+		return
+	}
+	if req.Cooldown {
+		containers = r.skipRecentlyChecked(containers)
+	}
+	if len(containers) == 0 {
+		r.lastSessionError = ""
+		return
+	}
+	// Dependents of the checked containers are stopped and recreated along
+	// with them, so the dependency graph needs all managed containers.
+	all, err := listTargetContainers(ctx, r.cli, r.cfg)
+	if err != nil {
+		logf(slog.LevelError, "list containers error: %v", err)
+		r.notifySessionError(fmt.Errorf("list containers: %w", err))
+		return
+	}
+	r.lastSessionError = ""
+	logf(slog.LevelDebug, "targeted check: %s", req.Reason)
+	r.runSession(ctx, "targeted check done", all, containers, checkOptions{SkipPull: req.SkipPull})
+}
+
+// skipRecentlyChecked drops containers that were pulled for moments ago,
+// typically because the updater itself has just recreated them.
+func (r *runner) skipRecentlyChecked(containers []container.Summary) []container.Summary {
+	out := containers[:0]
+	for _, c := range containers {
+		ref := containerRefFromSummary(c)
+		if t, ok := r.lastChecked[ref.Name]; ok && time.Since(t) < eventsCheckCooldown {
+			logContainerf(slog.LevelDebug, ref, "checked %s ago, skipping", time.Since(t).Round(time.Second))
 			continue
 		}
-		if wasUpdated {
-			updated++
-			info := shortID(newImageID)
-			if info == "" {
-				info = "unknown"
+		out = append(out, c)
+	}
+	return out
+}
+
+type sessionReport struct {
+	Report
+	// notifyNew is set when a pending or available update was first seen.
+	notifyNew bool
+	// transient holds this session's transient failures, which are not listed in Failed.
+	transient []ReportEntry
+}
+
+func (rep *sessionReport) addResult(ref containerRef, project string, res updateResult, dur time.Duration) {
+	e := ReportEntry{
+		Container:  ref.Name,
+		Project:    project,
+		Image:      res.ImageRef,
+		OldImageID: res.OldImageID,
+		NewImageID: res.NewImageID,
+		Old:        res.OldMeta,
+		New:        res.NewMeta,
+		CompareURL: compareURL(res.OldMeta, res.NewMeta),
+		Reason:     res.Reason,
+		Duration:   dur,
+	}
+	switch res.Status {
+	case updateApplied:
+		rep.Updated = append(rep.Updated, e)
+	case updatePending:
+		rep.Pending = append(rep.Pending, e)
+		rep.notifyNew = rep.notifyNew || res.Notify
+	case updateAvailable:
+		rep.Available = append(rep.Available, e)
+		rep.notifyNew = rep.notifyNew || res.Notify
+	case updateSkipped:
+		rep.Skipped = append(rep.Skipped, e)
+	}
+}
+
+// addFailure records a failed check or update. res describes the image as far
+// as it is known: the container's current one, or the planned update.
+func (rep *sessionReport) addFailure(ref containerRef, project string, res updateResult, err error, dur time.Duration) {
+	rep.FailedCount++
+	e := ReportEntry{
+		Container:  ref.Name,
+		Project:    project,
+		Image:      res.ImageRef,
+		OldImageID: res.OldImageID,
+		NewImageID: res.NewImageID,
+		Old:        res.OldMeta,
+		New:        res.NewMeta,
+		CompareURL: compareURL(res.OldMeta, res.NewMeta),
+		Error:      err.Error(),
+		Duration:   dur,
+	}
+	if isTransientError(err) {
+		rep.transient = append(rep.transient, e)
+		return
+	}
+	rep.Failed = append(rep.Failed, e)
+	if errors.Is(err, errRolledBack) {
+		rep.addRollback(ref, project, res, "old container restored", err)
+	}
+}
+
+// addRollback records a container that was put back to its old version
+// because of err.
+func (rep *sessionReport) addRollback(ref containerRef, project string, res updateResult, reason string, err error) {
+	rep.RolledBack = append(rep.RolledBack, ReportEntry{
+		Container:  ref.Name,
+		Project:    project,
+		Image:      res.ImageRef,
+		OldImageID: res.OldImageID,
+		NewImageID: res.NewImageID,
+		Old:        res.OldMeta,
+		New:        res.NewMeta,
+		CompareURL: compareURL(res.OldMeta, res.NewMeta),
+		Reason:     reason,
+		Error:      err.Error(),
+	})
+}
+
+// summaryResult describes the current image of a container for failures that
+// happen before an update was planned.
+func summaryResult(c container.Summary) updateResult {
+	return updateResult{ImageRef: c.Image, OldImageID: c.ImageID}
+}
+
+func (rep *sessionReport) events() []Event {
+	var events []Event
+	for _, c := range []struct {
+		ok bool
+		e  Event
+	}{
+		{rep.notifyNew, EventAvailable},
+		{len(rep.Updated) > 0, EventUpdated},
+		{len(rep.Failed) > 0, EventFailed},
+		{len(rep.Transient) > 0, EventTransient},
+		{len(rep.RolledBack) > 0, EventRollback},
+		{len(rep.Recovered) > 0, EventRecovered},
+	} {
+		if c.ok {
+			events = append(events, c.e)
+		}
+	}
+	return events
+}
+
+// runSession checks containers, a subset of all managed containers; all is
+// only used to find the dependents of the updated ones.
+func (r *runner) runSession(ctx context.Context, title string, all, containers []container.Summary, opts checkOptions) {
+	start := time.Now()
+	rep := &sessionReport{Report: Report{Host: r.cfg.Host, Title: title, StartedAt: start, Scanned: len(containers)}}
+
+	logf(slog.LevelDebug, "scan: %d container(s) eligible", rep.Scanned)
+
+	graph := buildDepGraph(ctx, r.cli, all)
+	containers = graph.order(containers)
+	// The updater's own container goes last: updating it ends this process.
+	slices.SortStableFunc(containers, func(a, b container.Summary) int {
+		return boolCompare(a.ID == r.selfID, b.ID == r.selfID)
+	})
+	units := sessionUnits(r.cfg, containers, r.selfID)
+	failedNames := map[string]bool{}
+
+	for i, u := range units {
+		if r.stopRequested() {
+			var rest []container.Summary
+			for _, u := range units[i:] {
+				rest = append(rest, u.containers...)
 			}
-			updatedRefs = append(updatedRefs, notifyRef{Name: ref.Name, Info: info})
+			logUnchecked(rest)
+			break
 		}
+		if u.project != "" {
+			r.runProject(ctx, u, graph, failedNames, rep, opts)
+			continue
+		}
+		r.runContainer(ctx, u.containers[0], graph, failedNames, rep, opts)
+	}
+
+	if r.selfUpdated != "" {
+		rep.Updated = append(rep.Updated, ReportEntry{Container: r.selfUpdated, Reason: "self-update completed"})
+		r.selfUpdated = ""
 	}
 
 	slog.Default().LogAttrs(
 		logCtx,
 		slog.LevelInfo,
-		"session done",
-		slog.Int("scanned", scanned),
-		slog.Int("updated", updated),
-		slog.Int("failed", failed),
+		title,
+		slog.Int("scanned", rep.Scanned),
+		slog.Int("updated", len(rep.Updated)),
+		slog.Int("pending", len(rep.Pending)),
+		slog.Int("available", len(rep.Available)),
+		slog.Int("skipped", len(rep.Skipped)),
+		slog.Int("failed", rep.FailedCount),
 		slog.Duration("duration", time.Since(start)),
 	)
 
-	if cfg.Notify != nil && (len(updatedRefs) > 0 || len(failedRefs) > 0) {
-		msg := buildNotificationMessage(updatedRefs, failedRefs)
-		if err := cfg.Notify(ctx, msg); err != nil {
-			logf(slog.LevelWarn, "telegram notify error: %v", err)
+	r.trackTransient(rep, containers)
+	r.dedupeFailures(rep, containers)
+	if rep.Events = rep.events(); len(rep.Events) > 0 {
+		rep.Duration = time.Since(start)
+		rep.Severity = maxSeverity(rep.Events)
+		r.deliver(rep.Report)
+	}
+}
+
+// trackTransient counts consecutive transient failures per container and
+// reports those reaching cfg.NotifyTransientAfter.
+func (r *runner) trackTransient(rep *sessionReport, checked []container.Summary) {
+	failing := map[string]bool{}
+	for _, e := range rep.transient {
+		failing[e.Container] = true
+		r.transientFailures[e.Container]++
+		if r.cfg.NotifyTransientAfter > 0 && r.transientFailures[e.Container] == r.cfg.NotifyTransientAfter {
+			rep.Transient = append(rep.Transient, e)
+		}
+	}
+	for _, c := range checked {
+		if name := containerRefFromSummary(c).Name; !failing[name] {
+			delete(r.transientFailures, name)
 		}
 	}
 }
 
-type notifyRef struct {
-	Name string
-	Info string
+func (r *runner) notifySessionError(err error) {
+	if err.Error() == r.lastSessionError {
+		return
+	}
+	r.lastSessionError = err.Error()
+	r.notify(Report{
+		Host:      r.cfg.Host,
+		Title:     string(EventSessionError),
+		StartedAt: time.Now(),
+		Events:    []Event{EventSessionError},
+		Severity:  SeverityError,
+		Notice:    err.Error(),
+	})
 }
 
-func buildNotificationMessage(updatedRefs, failedRefs []notifyRef) string {
-	var b strings.Builder
-	b.WriteString("<b>Up-to-date</b>")
-	if len(updatedRefs) > 0 {
-		b.WriteString("\n\n✅ Updated:\n")
-		writeRefList(&b, updatedRefs, false, false)
+func (r *runner) runContainer(ctx context.Context, c container.Summary, graph depGraph, failedNames map[string]bool, rep *sessionReport, opts checkOptions) {
+	start := time.Now()
+	ref := containerRefFromSummary(c)
+	if dep := graph.failedDependency(ref.Name, failedNames); dep != "" {
+		logContainerf(slog.LevelWarn, ref, "skipped: dependency %s failed", dep)
+		failedNames[ref.Name] = true
+		rep.addFailure(ref, "", summaryResult(c), fmt.Errorf("skipped: dependency %s failed", dep), 0)
+		return
 	}
-	if len(failedRefs) > 0 {
-		if b.Len() > 0 {
-			b.WriteString("\n\n")
+	if !opts.SkipPull {
+		r.lastChecked[ref.Name] = time.Now()
+	}
+	opts.Dependents = graph.runningDependents(ref.Name)
+	res, err := r.updateContainerIfNeeded(ctx, c, opts)
+	if err != nil {
+		logContainerf(slog.LevelError, ref, "update error: %v", err)
+		failedNames[ref.Name] = true
+		if res.ImageRef == "" {
+			res = summaryResult(c)
 		}
-		b.WriteString("❌ Failed:\n")
-		writeRefList(&b, failedRefs, true, true)
+		rep.addFailure(ref, "", res, err, time.Since(start))
+		return
 	}
-	return b.String()
+	rep.addResult(ref, "", res, time.Since(start))
 }
 
-func writeRefList(b *strings.Builder, refs []notifyRef, infoAsBlock, blankLineBetween bool) {
-	for i, ref := range refs {
-		if i > 0 && blankLineBetween {
-			b.WriteString("\n")
-		}
-		name := ref.Name
-		if name == "" {
-			name = "<noname>"
-		}
-		fmt.Fprintf(b, "\n• <code>%s</code>", html.EscapeString(name))
-		if ref.Info == "" {
-			continue
-		}
-		info := html.EscapeString(strings.TrimSpace(ref.Info))
-		if infoAsBlock {
-			fmt.Fprintf(b, "\n<pre>%s</pre>", info)
-		} else {
-			fmt.Fprintf(b, " – <code>%s</code>", info)
-		}
+func boolCompare(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+func logUnchecked(containers []container.Summary) {
+	names := make([]string, 0, len(containers))
+	for _, c := range containers {
+		names = append(names, containerRefFromSummary(c).Name)
 	}
+	logf(slog.LevelInfo, "shutdown: %d container(s) left unchecked: %s", len(names), strings.Join(names, ", "))
 }
@@ -0,0 +1,28 @@
+package app
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const labelInterval = "devem.tech/up-to-date.interval"
+
+// checkInterval returns the check interval of a container. An invalid label is
+// reported once per container and label value, not on every tick.
+func (r *runner) checkInterval(ref containerRef, labels map[string]string) time.Duration {
+	v, ok := labels[labelInterval]
+	if !ok {
+		return r.cfg.Interval
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil || d <= 0 {
+		if r.invalidIntervals[ref.Name] != v {
+			r.invalidIntervals[ref.Name] = v
+			logContainerf(slog.LevelWarn, ref, "invalid %s label %q, using %s", labelInterval, v, r.cfg.Interval)
+		}
+		return r.cfg.Interval
+	}
+	delete(r.invalidIntervals, ref.Name)
+	return max(d, r.cfg.Interval)
+}
@@ -0,0 +1,142 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/moby/moby/api/types/container"
+)
+
+const labelScope = "devem.tech/up-to-date.scope"
+
+// DefaultExcludeLabel opts a container out of updates; it is always honoured
+// in addition to --exclude-label.
+const DefaultExcludeLabel = "devem.tech/up-to-date.enabled=false"
+
+// Pattern matches container names and image references. It is a wildcard
+// pattern (see wildcardMatch) unless written as /regexp/.
+type Pattern struct {
+	raw string
+	re  *regexp.Regexp
+}
+
+func ParsePattern(s string) (Pattern, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Pattern{}, fmt.Errorf("empty pattern")
+	}
+	if len(s) > 2 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/") {
+		re, err := regexp.Compile(s[1 : len(s)-1])
+		if err != nil {
+			return Pattern{}, err
+		}
+		return Pattern{raw: s, re: re}, nil
+	}
+	return Pattern{raw: s}, nil
+}
+
+func (p Pattern) String() string { return p.raw }
+
+func (p Pattern) Match(s string) bool {
+	if p.re != nil {
+		return p.re.MatchString(s)
+	}
+	return wildcardMatch(p.raw, s)
+}
+
+// wildcardMatch reports whether s matches pat, where * matches any sequence of
+// characters, including "/", and ? matches a single character.
+func wildcardMatch(pat, s string) bool {
+	px, sx := 0, 0
+	// Where to resume after a mismatch: the last * and the next position in
+	// s it may extend to.
+	starPx, starSx := -1, 0
+	for px < len(pat) || sx < len(s) {
+		if px < len(pat) {
+			switch c := pat[px]; c {
+			case '*':
+				starPx, starSx = px, sx+1
+				px++
+				continue
+			case '?':
+				if sx < len(s) {
+					px++
+					sx++
+					continue
+				}
+			default:
+				if sx < len(s) && s[sx] == c {
+					px++
+					sx++
+					continue
+				}
+			}
+		}
+		if starPx >= 0 && starSx <= len(s) {
+			px, sx = starPx+1, starSx
+			starSx++
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func matchAnyPattern(patterns []Pattern, name, image string) bool {
+	for _, p := range patterns {
+		if p.Match(name) || p.Match(image) || p.Match(normalizeImageRef(image)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTargetSummary(cfg Config, c container.Summary) bool {
+	return isTargetContainer(cfg, containerRefFromSummary(c).Name, c.Image, c.Labels)
+}
+
+func isTargetContainer(cfg Config, name, image string, labels map[string]string) bool {
+	// Without --scope only unscoped containers are managed, so that an
+	// unscoped instance does not race scoped ones.
+	if strings.TrimSpace(labels[labelScope]) != cfg.Scope {
+		return false
+	}
+	if cfg.LabelEnable && !matchLabel(labels, cfg.Label) {
+		return false
+	}
+	for _, sel := range cfg.ExcludeLabels {
+		if matchLabel(labels, sel) {
+			return false
+		}
+	}
+	if len(cfg.Names) > 0 && !slices.Contains(cfg.Names, name) {
+		return false
+	}
+	if len(cfg.Include) > 0 && !matchAnyPattern(cfg.Include, name, image) {
+		return false
+	}
+	if matchAnyPattern(cfg.Exclude, name, image) {
+		return false
+	}
+	return true
+}
+
+func matchLabel(labels map[string]string, selector string) bool {
+	if labels == nil || selector == "" {
+		return false
+	}
+	key, value, hasValue := strings.Cut(selector, "=")
+	if key == "" {
+		return false
+	}
+	got, ok := labels[key]
+	if !ok {
+		return false
+	}
+	if !hasValue || value == "" {
+		return true
+	}
+	return got == value
+}
@@ -0,0 +1,68 @@
+package app
+
+import "testing"
+
+func TestWildcardMatch(t *testing.T) {
+	tests := []struct {
+		pat, s string
+		want   bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "ghcr.io/org/app:1", true},
+		{"nginx", "nginx", true},
+		{"nginx", "nginx-proxy", false},
+		{"nginx*", "nginx-proxy", true},
+		{"*proxy", "nginx-proxy", true},
+		{"*proxy", "nginx-proxy-1", false},
+		{"web-?", "web-1", true},
+		{"web-?", "web-", false},
+		{"web-?", "web-12", false},
+		{"?", "", false},
+		// * crosses "/", unlike shell globs.
+		{"ghcr.io/*", "ghcr.io/org/team/app", true},
+		{"ghcr.io/*/app", "ghcr.io/org/team/app", true},
+		{"*/library/*", "docker.io/library/nginx:1.27", true},
+		// Backtracking over several stars.
+		{"a*b*c", "aXbYbZc", true},
+		{"a*b*c", "aXbYbZ", false},
+		{"*a*a*a*", "aaa", true},
+		{"*a*a*a*", "aa", false},
+		{"**", "anything", true},
+		{"*?", "", false},
+		{"*?", "x", true},
+		// Regexp metacharacters are literal.
+		{"app.v1", "appxv1", false},
+		{"app.v1", "app.v1", true},
+		{"[ab]", "a", false},
+	}
+	for _, tt := range tests {
+		if got := wildcardMatch(tt.pat, tt.s); got != tt.want {
+			t.Errorf("wildcardMatch(%q, %q) = %v, want %v", tt.pat, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestPatternMatch(t *testing.T) {
+	tests := []struct {
+		pat, s string
+		want   bool
+	}{
+		{"web-*", "web-frontend", true},
+		{"/^web-[0-9]+$/", "web-12", true},
+		{"/^web-[0-9]+$/", "web-x", false},
+		// A lone "/" is a wildcard pattern, not an empty regexp.
+		{"/", "/", true},
+		{"//", "//", true},
+	}
+	for _, tt := range tests {
+		p, err := ParsePattern(tt.pat)
+		if err != nil {
+			t.Fatalf("ParsePattern(%q): %v", tt.pat, err)
+		}
+		if got := p.Match(tt.s); got != tt.want {
+			t.Errorf("%q.Match(%q) = %v, want %v", tt.pat, tt.s, got, tt.want)
+		}
+	}
+}
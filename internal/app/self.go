@@ -0,0 +1,216 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/client"
+)
+
+const (
+	handoffSuffix  = ".handoff"
+	handoffTimeout = 2 * time.Minute
+)
+
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// detectSelfContainerID finds the ID of the container this process runs in,
+// from the files Docker bind-mounts into it, the cgroup path, or the hostname
+// Docker assigns. A candidate is only accepted when its hostname is ours, so
+// that a host process never mistakes another container for itself.
+func detectSelfContainerID(ctx context.Context, cli *client.Client) string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+
+	var candidates []string
+	if b, err := os.ReadFile("/proc/self/mountinfo"); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			// Fields: mount ID, parent ID, major:minor, root, mount point, ...
+			f := strings.Fields(line)
+			if len(f) < 5 || f[4] != "/etc/hostname" && f[4] != "/etc/resolv.conf" {
+				continue
+			}
+			if i := strings.Index(f[3], "/containers/"); i >= 0 {
+				if id := containerIDPattern.FindString(f[3][i:]); id != "" {
+					candidates = append(candidates, id)
+					break
+				}
+			}
+		}
+	}
+	if b, err := os.ReadFile("/proc/self/cgroup"); err == nil {
+		if id := containerIDPattern.FindString(string(b)); id != "" {
+			candidates = append(candidates, id)
+		}
+	}
+	if len(hostname) == 12 {
+		candidates = append(candidates, hostname)
+	}
+
+	for _, id := range candidates {
+		ins, err := cli.ContainerInspect(ctx, id, client.ContainerInspectOptions{})
+		if err != nil || ins.Container.Config == nil {
+			continue
+		}
+		if ins.Container.Config.Hostname != hostname {
+			logf(slog.LevelDebug, "container %s has hostname %q, not %q; not treating it as self",
+				shortID(ins.Container.ID), ins.Container.Config.Hostname, hostname)
+			continue
+		}
+		return ins.Container.ID
+	}
+	return ""
+}
+
+// completeSelfHandoff runs in a freshly started updater. When it was started
+// as <name>.next by its predecessor, it stops and removes the old container and
+// takes over its name.
+func completeSelfHandoff(ctx context.Context, cli *client.Client, selfID string) (string, error) {
+	if selfID == "" {
+		return "", nil
+	}
+	ins, err := cli.ContainerInspect(ctx, selfID, client.ContainerInspectOptions{})
+	if err != nil {
+		return "", err
+	}
+	name := shortName(ins.Container.Name)
+	if !strings.HasSuffix(name, nextSuffix) || ins.Container.Config == nil || ins.Container.Config.Labels[labelReplaces] == "" {
+		return "", nil
+	}
+	base := strings.TrimSuffix(name, nextSuffix)
+	ref := containerRef{Name: base}
+
+	replaces := ins.Container.Config.Labels[labelReplaces]
+	if old, err := cli.ContainerInspect(ctx, base, client.ContainerInspectOptions{}); err == nil && old.Container.ID == replaces {
+		ref.ID = shortID(old.Container.ID)
+		logContainerf(slog.LevelInfo, ref, "self-update: stopping previous updater")
+		if _, err := cli.ContainerStop(ctx, old.Container.ID, client.ContainerStopOptions{}); err != nil {
+			return "", fmt.Errorf("stop previous updater: %w", err)
+		}
+		logContainerf(slog.LevelInfo, ref, "self-update: removing previous updater")
+		if _, err := cli.ContainerRemove(ctx, old.Container.ID, client.ContainerRemoveOptions{}); err != nil {
+			return "", fmt.Errorf("remove previous updater: %w", err)
+		}
+	}
+
+	self := containerRef{Name: name, ID: shortID(selfID)}
+	logContainerf(slog.LevelInfo, self, "self-update: renaming to %s", base)
+	if _, err := cli.ContainerRename(ctx, selfID, client.ContainerRenameOptions{NewName: base}); err != nil {
+		return "", fmt.Errorf("rename: %w", err)
+	}
+	return base, nil
+}
+
+// selfHandoff starts the updated updater as <name>.next and waits for it to
+// take over. With published ports the new container cannot start while this
+// one runs, so a short-lived helper container stops this one and starts it.
+func (r *runner) selfHandoff(ctx context.Context, plan *plannedUpdate) error {
+	cli, cur := r.cli, plan.cur
+	fullName := strings.TrimPrefix(cur.Name, "/")
+	nextName := fullName + nextSuffix
+
+	refNew := containerRef{Name: nextName}
+	r.progress.step(refNew, "self-update: creating new updater")
+	created, err := cli.ContainerCreate(ctx, client.ContainerCreateOptions{
+		Config:           newContainerConfig(ctx, cli, cur, plan.imageRef),
+		HostConfig:       cur.HostConfig,
+		NetworkingConfig: buildNetworkingConfig(cur),
+		Name:             nextName,
+	})
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	refNew.ID = shortID(created.ID)
+	defer r.progress.done()
+
+	if supportsRollingUpdate(cur) {
+		r.progress.step(refNew, "self-update: starting new updater")
+		if _, err := cli.ContainerStart(ctx, created.ID, client.ContainerStartOptions{}); err != nil {
+			removeContainer(ctx, cli, created.ID)
+			return fmt.Errorf("start: %w", err)
+		}
+	} else if err := r.startHandoffHelper(ctx, cur, plan.imageRef, created.ID); err != nil {
+		removeContainer(ctx, cli, created.ID)
+		return fmt.Errorf("handoff helper: %w", err)
+	}
+
+	r.progress.step(refNew, "self-update: waiting for new updater to take over")
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	deadline := time.NewTimer(handoffTimeout)
+	defer deadline.Stop()
+	for {
+		select {
+		case <-r.stopping:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			removeContainer(ctx, cli, created.ID)
+			return errors.New("handoff timed out")
+		case <-ticker.C:
+			ins, err := cli.ContainerInspect(ctx, created.ID, client.ContainerInspectOptions{})
+			if err != nil {
+				continue
+			}
+			if st := ins.Container.State; st != nil && (st.Status == container.StateExited || st.Status == container.StateDead) {
+				removeContainer(ctx, cli, created.ID)
+				return fmt.Errorf("new updater exited with code %d", st.ExitCode)
+			}
+		}
+	}
+}
+
+func (r *runner) startHandoffHelper(ctx context.Context, cur container.InspectResponse, imageRef, nextID string) error {
+	cfg := newContainerConfig(ctx, r.cli, cur, imageRef)
+	cfg.Cmd = []string{"self-handoff", cur.ID, nextID}
+	cfg.ExposedPorts = nil
+	cfg.Healthcheck = nil
+
+	hc := *cur.HostConfig
+	hc.PortBindings = nil
+	hc.PublishAllPorts = false
+	hc.AutoRemove = true
+	hc.RestartPolicy = container.RestartPolicy{}
+
+	name := strings.TrimPrefix(cur.Name, "/") + handoffSuffix
+	ref := containerRef{Name: name}
+	r.progress.step(ref, "self-update: starting handoff helper")
+	created, err := r.cli.ContainerCreate(ctx, client.ContainerCreateOptions{
+		Config:     cfg,
+		HostConfig: &hc,
+		Name:       name,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := r.cli.ContainerStart(ctx, created.ID, client.ContainerStartOptions{}); err != nil {
+		removeContainer(ctx, r.cli, created.ID)
+		return err
+	}
+	return nil
+}
+
+// SelfHandoff is run by the helper container: it stops the old updater and
+// starts the new one, which completes the handoff itself.
+func SelfHandoff(ctx context.Context, cli *client.Client, oldID, nextID string) error {
+	if _, err := cli.ContainerStop(ctx, oldID, client.ContainerStopOptions{}); err != nil {
+		return fmt.Errorf("stop old updater: %w", err)
+	}
+	if _, err := cli.ContainerStart(ctx, nextID, client.ContainerStartOptions{}); err != nil {
+		if _, serr := cli.ContainerStart(ctx, oldID, client.ContainerStartOptions{}); serr != nil {
+			return fmt.Errorf("start new updater: %w; restart old updater: %v", err, serr)
+		}
+		return fmt.Errorf("start new updater: %w", err)
+	}
+	return nil
+}
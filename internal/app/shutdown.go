@@ -0,0 +1,183 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/client"
+)
+
+const (
+	// labelReplaces is set on every container the updater creates and holds
+	// the ID of the container it replaces. Only containers carrying it are
+	// reconciled, so that containers merely named like the temporary ones are
+	// left alone.
+	labelReplaces = "devem.tech/up-to-date.replaces"
+
+	prevSuffix = ".prev"
+	nextSuffix = ".next"
+	// stoppedPrevSuffix marks the old container of a stopped one, which must
+	// not be started when reconciled.
+	stoppedPrevSuffix = ".prev-stopped"
+
+	cleanupTimeout = 30 * time.Second
+)
+
+// cleanupContext returns a context for undoing a failed update step. It
+// outlives the abort of ctx, since an aborted step must still be rolled back.
+func cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+}
+
+// removeContainer force-removes a container created by a failed update step.
+func removeContainer(ctx context.Context, cli *client.Client, id string) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+	if _, err := cli.ContainerRemove(ctx, id, client.ContainerRemoveOptions{Force: true}); err != nil {
+		logf(slog.LevelWarn, "remove container %s: %v", shortID(id), err)
+	}
+}
+
+// progress records the step of the update in flight, so that shutdown can
+// report what it interrupted.
+type progress struct {
+	mu   sync.Mutex
+	ref  containerRef
+	desc string
+}
+
+func (p *progress) step(ref containerRef, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	p.mu.Lock()
+	p.ref, p.desc = ref, msg
+	p.mu.Unlock()
+	logContainerf(slog.LevelInfo, ref, "%s", msg)
+}
+
+func (p *progress) done() {
+	p.mu.Lock()
+	p.ref, p.desc = containerRef{}, ""
+	p.mu.Unlock()
+}
+
+func (p *progress) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.desc == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s", p.ref.Name, p.desc)
+}
+
+// reconcileInterrupted finishes or rolls back updates that were aborted
+// mid-way, recognised by the temporary .prev/.next container names together
+// with the labelReplaces label of the container created in their place.
+func reconcileInterrupted(ctx context.Context, cli *client.Client, cfg Config, selfID string) {
+	res, err := cli.ContainerList(ctx, client.ContainerListOptions{All: true})
+	if err != nil {
+		logf(slog.LevelError, "reconcile: list containers error: %v", err)
+		return
+	}
+
+	byName := map[string]container.Summary{}
+	for _, c := range res.Items {
+		byName[containerRefFromSummary(c).Name] = c
+	}
+
+	for name, c := range byName {
+		if c.ID == selfID {
+			continue
+		}
+		base := name
+		for _, suffix := range []string{prevSuffix, stoppedPrevSuffix, nextSuffix} {
+			base = strings.TrimSuffix(base, suffix)
+		}
+		if base == name || !isTargetContainer(cfg, base, c.Image, c.Labels) {
+			continue
+		}
+		cur, hasCur := byName[base]
+		var err error
+		switch {
+		case strings.HasSuffix(name, nextSuffix):
+			// A rolling update labels the new container with the old one.
+			replaces := c.Labels[labelReplaces]
+			if replaces == "" || hasCur && cur.ID != replaces {
+				continue
+			}
+			err = reconcileNext(ctx, cli, c, base, cur, hasCur)
+		case !hasCur:
+			// Interrupted between the rename and the create; nothing proves
+			// the container was renamed by the updater.
+			logContainerf(slog.LevelWarn, containerRefFromSummary(c), "reconcile: no container %s; if an update was interrupted, rename it back manually", base)
+			continue
+		case cur.Labels[labelReplaces] != c.ID:
+			continue
+		default:
+			err = reconcilePrev(ctx, cli, c, cur, !strings.HasSuffix(name, stoppedPrevSuffix))
+		}
+		if err != nil {
+			logContainerf(slog.LevelError, containerRefFromSummary(c), "reconcile error: %v", err)
+		}
+	}
+}
+
+// reconcilePrev handles a recreate that stopped after the new container was
+// created in place of the old one.
+func reconcilePrev(ctx context.Context, cli *client.Client, prev, cur container.Summary, start bool) error {
+	ref := containerRefFromSummary(prev)
+	if start && cur.State != container.StateRunning {
+		logContainerf(slog.LevelWarn, containerRefFromSummary(cur), "reconcile: starting new container left created")
+		if _, err := cli.ContainerStart(ctx, cur.ID, client.ContainerStartOptions{}); err != nil {
+			return fmt.Errorf("start new: %w", err)
+		}
+	}
+	logContainerf(slog.LevelWarn, ref, "reconcile: removing old container")
+	if _, err := cli.ContainerRemove(ctx, prev.ID, client.ContainerRemoveOptions{}); err != nil {
+		return fmt.Errorf("remove: %w", err)
+	}
+	return nil
+}
+
+// reconcileNext handles a rolling update that stopped before the new
+// container took over the name.
+func reconcileNext(ctx context.Context, cli *client.Client, next container.Summary, base string, cur container.Summary, hasCur bool) error {
+	ref := containerRefFromSummary(next)
+	switch {
+	case hasCur && cur.State == container.StateRunning:
+		logContainerf(slog.LevelWarn, ref, "reconcile: old container still serving, removing new one")
+		if _, err := cli.ContainerRemove(ctx, next.ID, client.ContainerRemoveOptions{Force: true}); err != nil {
+			return fmt.Errorf("remove: %w", err)
+		}
+		return nil
+	case hasCur && next.State != container.StateRunning:
+		logContainerf(slog.LevelWarn, ref, "reconcile: new container not running, restarting old one")
+		if _, err := cli.ContainerStart(ctx, cur.ID, client.ContainerStartOptions{}); err != nil {
+			return fmt.Errorf("start old: %w", err)
+		}
+		if _, err := cli.ContainerRemove(ctx, next.ID, client.ContainerRemoveOptions{Force: true}); err != nil {
+			return fmt.Errorf("remove: %w", err)
+		}
+		return nil
+	case hasCur:
+		logContainerf(slog.LevelWarn, ref, "reconcile: old container stopped, removing it")
+		if _, err := cli.ContainerRemove(ctx, cur.ID, client.ContainerRemoveOptions{}); err != nil {
+			return fmt.Errorf("remove old: %w", err)
+		}
+	}
+
+	logContainerf(slog.LevelWarn, ref, "reconcile: renaming new container to %s", base)
+	if _, err := cli.ContainerRename(ctx, next.ID, client.ContainerRenameOptions{NewName: base}); err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+	if next.State != container.StateRunning {
+		if _, err := cli.ContainerStart(ctx, next.ID, client.ContainerStartOptions{}); err != nil {
+			return fmt.Errorf("start: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// slackNotifier posts to a Slack incoming webhook using Block Kit.
+type slackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewSlackNotifierFromEnv() (Notifier, error) {
+	endpoint := strings.TrimSpace(os.Getenv("SLACK_WEBHOOK_URL"))
+	if endpoint == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("SLACK_WEBHOOK_URL must be an https URL")
+	}
+
+	return slackNotifier{
+		url:    endpoint,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (n slackNotifier) Name() string { return "slack" }
+
+func (n slackNotifier) Notify(ctx context.Context, report Report) error {
+	body, err := json.Marshal(buildSlackMessage(report))
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.client, n.url, body, "slack")
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackMessage struct {
+	// Text is the fallback shown in push notifications.
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks,omitempty"`
+}
+
+var slackMarkup = listMarkup{
+	escape:  strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace,
+	project: func(s string) string { return "*" + s + "*" },
+	code:    func(s string) string { return "`" + s + "`" },
+	block:   func(s string) string { return "```" + s + "```" },
+	link: func(text, url string) string {
+		return "<" + strings.NewReplacer("|", "%7C", ">", "%3E").Replace(url) + "|" + text + ">"
+	},
+}
+
+func buildSlackMessage(report Report) slackMessage {
+	if report.Message != "" {
+		return slackMessage{Text: report.Message}
+	}
+	header := reportHeader(report)
+	msg := slackMessage{
+		Text:   header,
+		Blocks: []slackBlock{{Type: "header", Text: &slackText{Type: "plain_text", Text: header}}},
+	}
+	for _, sec := range reportSections(report) {
+		var b strings.Builder
+		b.WriteString("*" + sec.title + "*")
+		writeRefList(&b, sec, slackMarkup)
+		// Section text is limited to 3000 characters.
+		msg.Blocks = append(msg.Blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: truncate(b.String(), 3000)}})
+	}
+	msg.Blocks = append(msg.Blocks, slackBlock{Type: "context", Elements: []slackText{{
+		Type: "mrkdwn",
+		Text: fmt.Sprintf("%d scanned · %d failed · %s", report.Scanned, report.FailedCount, report.Duration.Round(time.Second)),
+	}}})
+	return msg
+}
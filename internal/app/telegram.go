@@ -0,0 +1,324 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// telegramMaxLength is the limit of one message, in UTF-16 code units.
+const telegramMaxLength = 4096
+
+type telegramChat struct {
+	id string
+	// threadID is the forum topic (message_thread_id), if any.
+	threadID string
+}
+
+func (c telegramChat) String() string {
+	if c.threadID == "" {
+		return c.id
+	}
+	return c.id + ":" + c.threadID
+}
+
+type telegramNotifier struct {
+	token string
+	chats []telegramChat
+	// silentSuccess delivers reports without warnings or errors silently.
+	silentSuccess bool
+	client        *http.Client
+}
+
+// NewTelegramNotifierFromEnv reads TELEGRAM_CHAT_ID as a comma-separated list
+// of chat IDs, each optionally followed by ":<topic id>".
+func NewTelegramNotifierFromEnv() (Notifier, error) {
+	token := strings.TrimSpace(os.Getenv("TELEGRAM_API_TOKEN"))
+	if token == "" {
+		return nil, nil
+	}
+	ids := splitList(os.Getenv("TELEGRAM_CHAT_ID"))
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("TELEGRAM_API_TOKEN set but chat id is missing")
+	}
+	defaultThread := strings.TrimSpace(os.Getenv("TELEGRAM_THREAD_ID"))
+	chats := make([]telegramChat, 0, len(ids))
+	for _, id := range ids {
+		chat := telegramChat{id: id, threadID: defaultThread}
+		if i := strings.LastIndex(id, ":"); i > 0 {
+			chat.id, chat.threadID = id[:i], id[i+1:]
+		}
+		if chat.threadID != "" {
+			if _, err := strconv.Atoi(chat.threadID); err != nil {
+				return nil, fmt.Errorf("invalid telegram topic id %q", chat.threadID)
+			}
+		}
+		chats = append(chats, chat)
+	}
+
+	var silentSuccess bool
+	if v := strings.TrimSpace(os.Getenv("TELEGRAM_SILENT_SUCCESS")); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("TELEGRAM_SILENT_SUCCESS: %w", err)
+		}
+		silentSuccess = b
+	}
+
+	return telegramNotifier{
+		token:         token,
+		chats:         chats,
+		silentSuccess: silentSuccess,
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (n telegramNotifier) Name() string { return "telegram" }
+
+func (n telegramNotifier) Notify(ctx context.Context, report Report) error {
+	var errs []error
+	for _, chat := range n.chats {
+		if _, err := n.notifyChat(ctx, chat, report, 0); err != nil {
+			errs = append(errs, fmt.Errorf("chat %s: %w", chat.id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// targets names the chats as configured, "<id>" or "<id>:<topic>".
+func (n telegramNotifier) targets() []string {
+	out := make([]string, 0, len(n.chats))
+	for _, chat := range n.chats {
+		out = append(out, chat.String())
+	}
+	return out
+}
+
+func (n telegramNotifier) notifyTarget(ctx context.Context, target string, report Report, skip int) (int, error) {
+	for _, chat := range n.chats {
+		if chat.String() == target {
+			return n.notifyChat(ctx, chat, report, skip)
+		}
+	}
+	return skip, fmt.Errorf("chat %s is not configured", target)
+}
+
+// notifyChat sends the parts of report to chat, starting after the first skip
+// parts, and returns how many parts have arrived.
+func (n telegramNotifier) notifyChat(ctx context.Context, chat telegramChat, report Report, skip int) (int, error) {
+	parts := splitTelegramHTML(buildNotificationMessage(report), telegramMaxLength)
+	silent := n.silentSuccess && report.Severity == SeverityInfo
+	for i := skip; i < len(parts); i++ {
+		if err := n.send(ctx, chat, parts[i], silent); err != nil {
+			return i, err
+		}
+	}
+	return len(parts), nil
+}
+
+// send delivers one message, falling back to plain text if Telegram cannot
+// parse the HTML.
+func (n telegramNotifier) send(ctx context.Context, chat telegramChat, text string, silent bool) error {
+	err := n.sendMessage(ctx, chat, text, "HTML", silent)
+	var se *statusError
+	if errors.As(err, &se) && se.code == http.StatusBadRequest && strings.Contains(se.body, "can't parse entities") {
+		logf(slog.LevelWarn, "telegram rejected HTML, resending as plain text: %s", se.body)
+		return n.sendMessage(ctx, chat, htmlToText(text), "", silent)
+	}
+	return err
+}
+
+func (n telegramNotifier) sendMessage(ctx context.Context, chat telegramChat, text, parseMode string, silent bool) error {
+	form := url.Values{}
+	form.Set("chat_id", chat.id)
+	form.Set("text", text)
+	if parseMode != "" {
+		form.Set("parse_mode", parseMode)
+	}
+	if chat.threadID != "" {
+		form.Set("message_thread_id", chat.threadID)
+	}
+	if silent {
+		form.Set("disable_notification", "true")
+	}
+
+	endpoint := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", n.token)
+	return sendWithRetry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return doNotifyRequest(n.client, req, "telegram")
+	})
+}
+
+func buildNotificationMessage(report Report) string {
+	if report.Message != "" {
+		return report.messageAsHTML()
+	}
+	var b strings.Builder
+	b.WriteString("<b>" + html.EscapeString(reportHeader(report)) + "</b>")
+	for _, sec := range reportSections(report) {
+		b.WriteString("\n\n" + sec.title + ":\n")
+		writeRefList(&b, sec, htmlMarkup)
+	}
+	return b.String()
+}
+
+var htmlMarkup = listMarkup{
+	escape:  html.EscapeString,
+	project: func(s string) string { return "<b>" + s + "</b>" },
+	code:    func(s string) string { return "<code>" + s + "</code>" },
+	block:   func(s string) string { return "<pre>" + s + "</pre>" },
+	link: func(text, url string) string {
+		return `<a href="` + html.EscapeString(url) + `">` + text + "</a>"
+	},
+}
+
+// splitTelegramHTML splits an HTML message into parts of at most limit
+// UTF-16 code units, preferably at line breaks. Tags open at a split are
+// closed at the end of the part and opened again at the start of the next.
+func splitTelegramHTML(s string, limit int) []string {
+	if utf16Len(s) <= limit {
+		return []string{s}
+	}
+
+	type token struct {
+		text string
+		// open and close are set for tags; name is the tag name.
+		open, close bool
+		name        string
+	}
+	var tokens []token
+	for i := 0; i < len(s); {
+		j := i + 1
+		switch s[i] {
+		case '<':
+			if k := strings.IndexByte(s[i:], '>'); k > 0 {
+				j = i + k + 1
+				tag := s[i+1 : j-1]
+				closing := strings.HasPrefix(tag, "/")
+				if fields := strings.Fields(strings.TrimPrefix(tag, "/")); len(fields) > 0 {
+					name := strings.ToLower(fields[0])
+					tokens = append(tokens, token{text: s[i:j], open: !closing, close: closing, name: name})
+					i = j
+					continue
+				}
+				j = i + 1
+			}
+		case '&':
+			if k := strings.IndexByte(s[i:], ';'); k > 0 && k < 10 {
+				j = i + k + 1
+			}
+		default:
+			for j < len(s) && s[j]&0xC0 == 0x80 {
+				j++
+			}
+		}
+		tokens = append(tokens, token{text: s[i:j]})
+		i = j
+	}
+
+	closers := func(stack []token) string {
+		var b strings.Builder
+		for i := len(stack) - 1; i >= 0; i-- {
+			b.WriteString("</" + stack[i].name + ">")
+		}
+		return b.String()
+	}
+	openers := func(stack []token) string {
+		var b strings.Builder
+		for _, t := range stack {
+			b.WriteString(t.text)
+		}
+		return b.String()
+	}
+	apply := func(stack []token, t token) []token {
+		switch {
+		case t.open:
+			return append(stack, t)
+		case t.close:
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].name == t.name {
+					return stack[:i]
+				}
+			}
+		}
+		return stack
+	}
+
+	var parts []string
+	var stack []token
+	for start := 0; start < len(tokens); {
+		prefix := openers(stack)
+		size := utf16Len(prefix)
+		cur := append([]token(nil), stack...)
+		end, cut := start, -1
+		var cutStack []token
+		for end < len(tokens) {
+			next := apply(append([]token(nil), cur...), tokens[end])
+			if size+utf16Len(tokens[end].text)+utf16Len(closers(next)) > limit && end > start {
+				break
+			}
+			size += utf16Len(tokens[end].text)
+			cur = next
+			end++
+			if tokens[end-1].text == "\n" {
+				cut, cutStack = end, cur
+			}
+		}
+		if end < len(tokens) && cut > start {
+			end, cur = cut, cutStack
+		}
+
+		var b strings.Builder
+		b.WriteString(prefix)
+		for _, t := range tokens[start:end] {
+			b.WriteString(t.text)
+		}
+		b.WriteString(closers(cur))
+		if part := strings.TrimSpace(b.String()); part != "" {
+			parts = append(parts, part)
+		}
+		start, stack = end, cur
+	}
+	return parts
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// htmlToText drops tags and entities for the plain-text fallback.
+func htmlToText(s string) string {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:i])
+		j := strings.IndexByte(s[i:], '>')
+		if j < 0 {
+			b.WriteString(s[i:])
+			break
+		}
+		s = s[i+j+1:]
+	}
+	return html.UnescapeString(b.String())
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitTelegramHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		limit int
+		// parts is the expected number of parts; 0 means more than one.
+		parts int
+	}{
+		{
+			name:  "fits",
+			in:    "<b>Up-to-date</b>\n• <code>nginx</code> – 0123456789ab",
+			limit: 100,
+			parts: 1,
+		},
+		{
+			name:  "lines",
+			in:    strings.Repeat("• <code>web</code> – <i>1.2.3</i> updated\n", 40),
+			limit: 120,
+		},
+		{
+			name:  "long pre block",
+			in:    "<b>❌ Failed</b>\n<pre>" + strings.Repeat("pull: toomanyrequests: rate limit\n", 30) + "</pre>\ndone",
+			limit: 150,
+		},
+		{
+			name:  "nested tags",
+			in:    "<b>" + strings.Repeat("<a href=\"https://example.org/a?b=1&amp;c=2\"><i>compare</i></a>\n", 20) + "</b>",
+			limit: 160,
+		},
+		{
+			name:  "text without newlines",
+			in:    "<pre>" + strings.Repeat("abcdefghij", 50) + "</pre>",
+			limit: 64,
+		},
+		{
+			name:  "entities",
+			in:    strings.Repeat("a &amp; b &lt;c&gt; &quot;d&quot; ", 20),
+			limit: 30,
+		},
+		{
+			name:  "surrogate pairs",
+			in:    "<b>" + strings.Repeat("😀", 40) + "</b>",
+			limit: 17,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := splitTelegramHTML(tt.in, tt.limit)
+			switch {
+			case tt.parts > 0 && len(parts) != tt.parts:
+				t.Fatalf("got %d part(s), want %d", len(parts), tt.parts)
+			case tt.parts == 0 && len(parts) < 2:
+				t.Fatalf("got %d part(s), want a split", len(parts))
+			}
+
+			var text strings.Builder
+			for i, p := range parts {
+				if n := utf16Len(p); n > tt.limit {
+					t.Errorf("part %d has %d UTF-16 units, limit %d:\n%s", i, n, tt.limit, p)
+				}
+				if err := checkBalancedHTML(p); err != "" {
+					t.Errorf("part %d: %s:\n%s", i, err, p)
+				}
+				text.WriteString(htmlToText(p))
+			}
+			// Nothing is lost or duplicated, apart from whitespace at the splits.
+			if got, want := stripSpace(text.String()), stripSpace(htmlToText(tt.in)); got != want {
+				t.Errorf("text of the parts differs from the input:\ngot  %q\nwant %q", got, want)
+			}
+		})
+	}
+}
+
+// checkBalancedHTML returns what is wrong with the tags and entities of s, or
+// "" when every tag is closed in order and no entity is cut off.
+func checkBalancedHTML(s string) string {
+	var stack []string
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '<':
+			j := strings.IndexByte(s[i:], '>')
+			if j < 0 {
+				return "unterminated tag"
+			}
+			tag := s[i+1 : i+j]
+			i += j
+			if name, ok := strings.CutPrefix(tag, "/"); ok {
+				if len(stack) == 0 || stack[len(stack)-1] != name {
+					return "unexpected </" + name + ">"
+				}
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			stack = append(stack, strings.Fields(tag)[0])
+		case '&':
+			if j := strings.IndexByte(s[i:], ';'); j < 0 || j > 9 {
+				return "cut entity"
+			}
+		}
+	}
+	if len(stack) > 0 {
+		return "unclosed <" + strings.Join(stack, "><") + ">"
+	}
+	return ""
+}
+
+func stripSpace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
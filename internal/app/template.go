@@ -0,0 +1,69 @@
+package app
+
+import (
+	"html"
+	htmltemplate "html/template"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// notifyTemplate renders a user-supplied notification text from a Report.
+type notifyTemplate struct {
+	tmpl interface {
+		Execute(w io.Writer, data any) error
+	}
+	html bool
+}
+
+var templateFuncs = map[string]any{
+	"short": shortID,
+}
+
+// loadNotifyTemplate parses path as html/template for .html/.htm files and
+// as text/template otherwise. A broken template disables it with a warning.
+func loadNotifyTemplate(path string) *notifyTemplate {
+	if path == "" {
+		return nil
+	}
+	name := filepath.Base(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		t, err := htmltemplate.New(name).Funcs(templateFuncs).ParseFiles(path)
+		if err == nil {
+			return &notifyTemplate{tmpl: t, html: true}
+		}
+		logf(slog.LevelWarn, "notify template %s: %v; using built-in format", path, err)
+	default:
+		t, err := texttemplate.New(name).Funcs(templateFuncs).ParseFiles(path)
+		if err == nil {
+			return &notifyTemplate{tmpl: t}
+		}
+		logf(slog.LevelWarn, "notify template %s: %v; using built-in format", path, err)
+	}
+	return nil
+}
+
+// render sets report.Message, leaving it empty if the template fails.
+func (t *notifyTemplate) render(report *Report) {
+	if t == nil {
+		return
+	}
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, report); err != nil {
+		logf(slog.LevelWarn, "notify template: %v; using built-in format", err)
+		return
+	}
+	report.Message = strings.TrimSpace(b.String())
+	report.messageHTML = t.html
+}
+
+// messageAsHTML returns report.Message for HTML-formatted destinations.
+func (r Report) messageAsHTML() string {
+	if r.messageHTML {
+		return r.Message
+	}
+	return html.EscapeString(r.Message)
+}
@@ -8,16 +8,105 @@ import (
 	"strings"
 	"time"
 
-	"github.com/devem-tech/up-to-date/internal/dockerauth"
 	"github.com/moby/moby/api/types/container"
 	"github.com/moby/moby/client"
 )
 
-func updateContainerIfNeeded(ctx context.Context, cli *client.Client, auths dockerauth.Index, cfg Config, summary container.Summary) (bool, string, error) {
+type checkOptions struct {
+	// SkipPull compares against the locally present image instead of pulling.
+	SkipPull bool
+	// Dependents are stopped before the container is replaced and brought back
+	// afterwards.
+	Dependents []container.InspectResponse
+}
+
+type updateStatus int
+
+const (
+	updateNone updateStatus = iota
+	updateApplied
+	updatePending
+	updateAvailable
+	updateSkipped
+)
+
+type updateResult struct {
+	Status     updateStatus
+	ImageRef   string
+	OldImageID string
+	NewImageID string
+	OldMeta    ImageMeta
+	NewMeta    ImageMeta
+	// Reason explains a pending or skipped update.
+	Reason string
+	// Notify is set for pending or available updates first detected in this check.
+	Notify bool
+}
+
+// plannedUpdate is a detected update; checkContainer returns it once it is
+// ready to be applied.
+type plannedUpdate struct {
+	cur        container.InspectResponse
+	ref        containerRef
+	imageRef   string
+	oldImageID string
+	newImageID string
+	oldMeta    ImageMeta
+	newMeta    ImageMeta
+}
+
+func (p *plannedUpdate) result(status updateStatus) updateResult {
+	return updateResult{
+		Status:     status,
+		ImageRef:   p.imageRef,
+		OldImageID: p.oldImageID,
+		NewImageID: p.newImageID,
+		OldMeta:    p.oldMeta,
+		NewMeta:    p.newMeta,
+	}
+}
+
+// String describes the update for logs, e.g. "nginx:1 (0123456789ab) [1.4.2 → 1.5.0]".
+func (p *plannedUpdate) String() string {
+	s := fmt.Sprintf("%s (%s)", p.imageRef, shortID(p.newImageID))
+	if change := describeChange(p.oldMeta, p.newMeta); change != "" {
+		s += " [" + change + "]"
+	}
+	return s
+}
+
+// replacedContainer is an old container kept aside by applyUpdate with
+// keepOld set, until the update is committed or rolled back.
+type replacedContainer struct {
+	ref        containerRef
+	id         string
+	name       string
+	start      bool
+	oldImageID string
+}
+
+func (r *runner) updateContainerIfNeeded(ctx context.Context, summary container.Summary, opts checkOptions) (updateResult, error) {
+	plan, res, err := r.checkContainer(ctx, summary, opts)
+	if err != nil || plan == nil {
+		return res, err
+	}
+	if _, err := r.applyUpdate(ctx, plan, opts, false); err != nil {
+		return plan.result(updateNone), err
+	}
+	r.applied(plan)
+	return plan.result(updateApplied), nil
+}
+
+// checkContainer pulls the image of a container and decides whether it should
+// be updated. A nil plan means there is nothing to apply; res then tells why.
+func (r *runner) checkContainer(ctx context.Context, summary container.Summary, opts checkOptions) (*plannedUpdate, updateResult, error) {
+	cli, cfg := r.cli, r.cfg
 	ref := containerRefFromSummary(summary)
-	ins, err := cli.ContainerInspect(ctx, summary.ID, client.ContainerInspectOptions{})
+	// By name: the container may have been recreated earlier in this session
+	// as a dependent of another one.
+	ins, err := cli.ContainerInspect(ctx, ref.Name, client.ContainerInspectOptions{})
 	if err != nil {
-		return false, "", fmt.Errorf("inspect container: %w", err)
+		return nil, updateResult{}, fmt.Errorf("inspect container: %w", err)
 	}
 
 	cur := ins.Container
@@ -25,7 +114,7 @@ func updateContainerIfNeeded(ctx context.Context, cli *client.Client, auths dock
 
 	imageRef := cur.Config.Image
 	if imageRef == "" {
-		return false, "", errors.New("container has empty Config.Image")
+		return nil, updateResult{}, errors.New("container has empty Config.Image")
 	}
 
 	oldImageID := cur.Image
@@ -35,50 +124,190 @@ func updateContainerIfNeeded(ctx context.Context, cli *client.Client, auths dock
 		}
 	}
 
+	if ok, rule := cfg.Policy.evaluate(imageRef); !ok {
+		logContainerf(slog.LevelWarn, ref, "skipped %s: denied by %s", imageRef, rule)
+		return nil, updateResult{Status: updateSkipped, ImageRef: imageRef, Reason: "denied by " + rule}, nil
+	}
+
 	logContainerf(slog.LevelDebug, ref, "checking for updates (%s)", imageRef)
 
-	regAuth, _ := auths.RegistryAuthForImageRef(imageRef)
-	if err := pullImage(ctx, cli, imageRef, regAuth); err != nil {
-		return false, "", fmt.Errorf("pull %q: %w", imageRef, err)
+	monitorOnly := cfg.MonitorOnly || matchLabel(cur.Config.Labels, cfg.MonitorLabel)
+	regAuth, _ := r.auths.RegistryAuthForImageRef(imageRef)
+
+	plan := &plannedUpdate{
+		cur:        cur,
+		ref:        ref,
+		imageRef:   imageRef,
+		oldImageID: oldImageID,
+	}
+
+	if monitorOnly && !cfg.MonitorPull && !opts.SkipPull {
+		digest, err := remoteDigestIfChanged(ctx, cli, imageRef, regAuth, oldImageID)
+		if err != nil {
+			return nil, updateResult{}, fmt.Errorf("resolve %q: %w", imageRef, err)
+		}
+		if digest == "" {
+			logContainerf(slog.LevelDebug, ref, "no update")
+			return nil, updateResult{}, nil
+		}
+		// Not pulled, so only the old image's metadata is known.
+		plan.newImageID = digest
+		plan.oldMeta = inspectImageMeta(ctx, cli, oldImageID)
+		return nil, r.reportAvailable(plan), nil
+	}
+
+	if !opts.SkipPull {
+		r.pulls.mark(imageRef, time.Now())
+		err := pullImage(ctx, cli, imageRef, regAuth)
+		r.pulls.mark(imageRef, time.Now())
+		if err != nil {
+			return nil, updateResult{}, fmt.Errorf("pull %q: %w", imageRef, err)
+		}
 	}
 
 	newImg, err := cli.ImageInspect(ctx, imageRef)
 	if err != nil {
-		return false, "", fmt.Errorf("inspect pulled image %q: %w", imageRef, err)
+		return nil, updateResult{}, fmt.Errorf("inspect pulled image %q: %w", imageRef, err)
 	}
 	newImageID := newImg.ID
 
 	if newImageID == "" || oldImageID == "" || newImageID == oldImageID {
 		logContainerf(slog.LevelDebug, ref, "no update")
-		return false, "", nil
+		return nil, updateResult{}, nil
+	}
+	plan.newImageID = newImageID
+	plan.oldMeta = inspectImageMeta(ctx, cli, oldImageID)
+	if newImg.Config != nil {
+		plan.newMeta = imageMetaFromLabels(newImg.Config.Labels)
 	}
 
-	logContainerf(slog.LevelInfo, ref, "update available %s (%s)", imageRef, shortID(newImageID))
+	if monitorOnly {
+		return nil, r.reportAvailable(plan), nil
+	}
 
-	if supportsRollingUpdate(cur) && hasRollingLabel(cur, cfg.RollingLabel) {
-		if err := rollingUpdateContainer(ctx, cli, cur, imageRef); err != nil {
-			return false, "", fmt.Errorf("rolling update: %w", err)
-		}
-	} else {
-		if err := recreateContainer(ctx, cli, cur, imageRef); err != nil {
-			return false, "", err
+	if minAge := r.minImageAge(ref, cur.Config.Labels); minAge > 0 {
+		now := time.Now()
+		firstSeen, isNew := r.imagesSeen.firstSeen(newImageID, now)
+		age := now.Sub(imageCreatedAt(newImg.Created, firstSeen, now))
+		if age < minAge {
+			res := plan.result(updatePending)
+			res.Reason = fmt.Sprintf("cooling down, %s left", (minAge - age).Round(time.Second))
+			res.Notify = isNew
+			logContainerf(slog.LevelInfo, ref, "update pending %s: %s", plan, res.Reason)
+			return nil, res, nil
 		}
 	}
 
-	if cfg.Cleanup {
-		removed, reason, err := cleanupOldImageIfUnused(ctx, cli, oldImageID)
+	if matchLabel(cur.Config.Labels, cfg.ApprovalLabel) {
+		allowed, res, err := r.approvals.gate(plan, cfg.ApprovalTTL)
 		if err != nil {
-			logContainerf(slog.LevelWarn, ref, "cleanup error for %s: %v", shortID(oldImageID), err)
-		} else if removed {
-			logContainerf(slog.LevelInfo, ref, "removed old image %s (%s)", shortID(oldImageID), reason)
-		} else {
-			logContainerf(slog.LevelInfo, ref, "skipped old image %s (%s)", shortID(oldImageID), reason)
+			return nil, updateResult{}, fmt.Errorf("approval: %w", err)
+		}
+		if !allowed {
+			logContainerf(slog.LevelInfo, ref, "update pending %s: %s", plan, res.Reason)
+			return nil, res, nil
+		}
+		logContainerf(slog.LevelInfo, ref, "update %s approved", plan)
+	}
+
+	logContainerf(slog.LevelInfo, ref, "update available %s", plan)
+
+	return plan, updateResult{}, nil
+}
+
+// applyUpdate replaces the container of plan. With keepOld the old container
+// is left stopped under a temporary name and returned, so that the caller can
+// commit or roll back several updates together.
+func (r *runner) applyUpdate(ctx context.Context, plan *plannedUpdate, opts checkOptions, keepOld bool) (*replacedContainer, error) {
+	cli, cfg := r.cli, r.cfg
+	cur, ref := plan.cur, plan.ref
+
+	if cur.ID == r.selfID {
+		if err := r.selfHandoff(ctx, plan); err != nil {
+			return nil, fmt.Errorf("self-update: %w", err)
+		}
+		return nil, nil
+	}
+
+	if len(opts.Dependents) > 0 {
+		stopDependents(ctx, cli, opts.Dependents, r.progress)
+		defer restoreDependents(ctx, cli, ref.Name, opts.Dependents, r.progress)
+	}
+
+	// Stopped containers are recreated but left stopped.
+	active := cur.State != nil && (cur.State.Running || cur.State.Restarting)
+	if !keepOld && active && supportsRollingUpdate(cur) && hasRollingLabel(cur, cfg.RollingLabel) {
+		if err := rollingUpdateContainer(ctx, cli, plan, r.progress); err != nil {
+			return nil, fmt.Errorf("rolling update: %w", err)
 		}
 	} else {
+		replaced, err := recreateContainer(ctx, cli, cur, plan.imageRef, recreateOptions{Start: active, KeepOld: keepOld, Change: plan.String()}, r.progress)
+		if err != nil {
+			return nil, err
+		}
+		if keepOld {
+			replaced.oldImageID = plan.oldImageID
+			return replaced, nil
+		}
+	}
+
+	r.cleanupOldImage(ctx, ref, plan.oldImageID)
+	return nil, nil
+}
+
+// applied forgets per-update state once plan has been rolled out.
+func (r *runner) applied(plan *plannedUpdate) {
+	if !matchLabel(plan.cur.Config.Labels, r.cfg.ApprovalLabel) {
+		return
+	}
+	if err := r.approvals.remove(plan.ref.Name); err != nil {
+		logContainerf(slog.LevelWarn, plan.ref, "approval cleanup: %v", err)
+	}
+}
+
+func (r *runner) cleanupOldImage(ctx context.Context, ref containerRef, oldImageID string) {
+	if !r.cfg.Cleanup {
 		logContainerf(slog.LevelDebug, ref, "cleanup disabled: keeping old image %s", shortID(oldImageID))
+		return
 	}
+	removed, reason, err := cleanupOldImageIfUnused(ctx, r.cli, oldImageID)
+	if err != nil {
+		logContainerf(slog.LevelWarn, ref, "cleanup error for %s: %v", shortID(oldImageID), err)
+	} else if removed {
+		logContainerf(slog.LevelInfo, ref, "removed old image %s (%s)", shortID(oldImageID), reason)
+	} else {
+		logContainerf(slog.LevelInfo, ref, "skipped old image %s (%s)", shortID(oldImageID), reason)
+	}
+}
 
-	return true, newImageID, nil
+// commitReplaced removes an old container kept aside by applyUpdate.
+func (r *runner) commitReplaced(ctx context.Context, old *replacedContainer) {
+	logContainerf(slog.LevelInfo, old.ref, "removing old container")
+	if _, err := r.cli.ContainerRemove(ctx, old.id, client.ContainerRemoveOptions{}); err != nil {
+		logContainerf(slog.LevelWarn, old.ref, "remove old container: %v", err)
+	}
+	r.cleanupOldImage(ctx, old.ref, old.oldImageID)
+}
+
+// rollbackReplaced removes the new container and puts the old one back,
+// starting it if start is set.
+func (r *runner) rollbackReplaced(ctx context.Context, old *replacedContainer, start bool) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+	logContainerf(slog.LevelWarn, containerRef{Name: old.name}, "rolling back: removing new container")
+	if _, err := r.cli.ContainerRemove(ctx, old.name, client.ContainerRemoveOptions{Force: true}); err != nil {
+		logContainerf(slog.LevelError, containerRef{Name: old.name}, "roll back: remove new container: %v", err)
+		return
+	}
+	restorePrevContainer(ctx, r.cli, old.id, old.name, old.ref, start)
+}
+
+func (r *runner) reportAvailable(plan *plannedUpdate) updateResult {
+	logContainerf(slog.LevelInfo, plan.ref, "update available %s, monitor only", plan)
+	res := plan.result(updateAvailable)
+	res.Notify = r.announced[plan.ref.Name] != plan.newImageID
+	r.announced[plan.ref.Name] = plan.newImageID
+	return res
 }
 
 func supportsRollingUpdate(cur container.InspectResponse) bool {
@@ -98,49 +327,67 @@ func supportsRollingUpdate(cur container.InspectResponse) bool {
 }
 
 func hasRollingLabel(cur container.InspectResponse, label string) bool {
-	if cur.Config == nil || cur.Config.Labels == nil {
-		return false
-	}
-	if label == "" {
+	if cur.Config == nil {
 		return false
 	}
-	key, value, hasValue := strings.Cut(label, "=")
-	if key == "" {
-		return false
-	}
-	got, ok := cur.Config.Labels[key]
-	if !ok {
-		return false
-	}
-	if !hasValue || value == "" {
-		return true
-	}
-	return got == value
+	return matchLabel(cur.Config.Labels, label)
+}
+
+type recreateOptions struct {
+	// Start the new container; stopped containers are recreated stopped.
+	Start bool
+	// KeepOld leaves the old container stopped under its temporary name and
+	// returns it instead of removing it.
+	KeepOld bool
+	// Change describes the update in the success log, see plannedUpdate.String.
+	Change string
 }
 
-func recreateContainer(ctx context.Context, cli *client.Client, cur container.InspectResponse, imageRef string) error {
+func recreateContainer(ctx context.Context, cli *client.Client, cur container.InspectResponse, imageRef string, opts recreateOptions, prog *progress) (*replacedContainer, error) {
+	start := opts.Start
 	fullName := strings.TrimPrefix(cur.Name, "/")
+	prevName := fullName + prevSuffix
+	if !start {
+		prevName = fullName + stoppedPrevSuffix
+	}
+	// On failure the old container is restarted, except with KeepOld: then
+	// the caller starts it once the rest of its group is rolled back, since it
+	// may join the namespace of one of them.
+	restart := start && !opts.KeepOld
 	netCfg := buildNetworkingConfig(cur)
 
-	newConfig := cur.Config
-	newConfig.Image = imageRef
+	newConfig := newContainerConfig(ctx, cli, cur, imageRef)
 
 	refOld := containerRefFromInspect(cur)
-	logContainerf(slog.LevelInfo, refOld, "stopping container")
-	if _, err := cli.ContainerStop(ctx, cur.ID, client.ContainerStopOptions{}); err != nil {
-		return fmt.Errorf("stop: %w", err)
+	if start {
+		prog.step(refOld, "stopping container")
+		if _, err := cli.ContainerStop(ctx, cur.ID, client.ContainerStopOptions{}); err != nil {
+			// An aborted stop may still have stopped the container, and
+			// nothing marks it for reconcileInterrupted yet.
+			if restart {
+				cctx, cancel := cleanupContext(ctx)
+				restartOld(cctx, cli, cur.ID, refOld)
+				cancel()
+			}
+			return nil, fmt.Errorf("stop: %w", err)
+		}
 	}
 
-	logContainerf(slog.LevelInfo, refOld, "removing container")
-	if _, err := cli.ContainerRemove(ctx, cur.ID, client.ContainerRemoveOptions{
-		Force:         false,
-		RemoveVolumes: false,
-	}); err != nil {
-		return fmt.Errorf("remove: %w", err)
+	// The old container is kept under a temporary name until the new one runs,
+	// so an interrupted update can be rolled back or finished on next start.
+	prog.step(refOld, "renaming container to %s", prevName)
+	if _, err := cli.ContainerRename(ctx, cur.ID, client.ContainerRenameOptions{NewName: prevName}); err != nil {
+		if restart {
+			cctx, cancel := cleanupContext(ctx)
+			restartOld(cctx, cli, cur.ID, refOld)
+			cancel()
+		}
+		return nil, fmt.Errorf("rename: %w", err)
 	}
+	refOld.Name = prevName
 
 	refNew := containerRef{Name: fullName, ID: ""}
-	logContainerf(slog.LevelInfo, refNew, "creating container")
+	prog.step(refNew, "creating container")
 	created, err := cli.ContainerCreate(ctx, client.ContainerCreateOptions{
 		Config:           newConfig,
 		HostConfig:       cur.HostConfig,
@@ -148,33 +395,91 @@ func recreateContainer(ctx context.Context, cli *client.Client, cur container.In
 		Name:             fullName,
 	})
 	if err != nil {
-		return fmt.Errorf("create: %w", err)
+		err = fmt.Errorf("create: %w", err)
+		cctx, cancel := cleanupContext(ctx)
+		defer cancel()
+		if restorePrevContainer(cctx, cli, cur.ID, fullName, refOld, restart) {
+			err = rolledBack(err)
+		}
+		return nil, err
 	}
 	refNew.ID = shortID(created.ID)
 	if len(created.Warnings) > 0 {
 		logContainerf(slog.LevelWarn, refNew, "create warnings: %v", created.Warnings)
 	}
 
-	logContainerf(slog.LevelInfo, refNew, "starting container")
-	if _, err := cli.ContainerStart(ctx, created.ID, client.ContainerStartOptions{}); err != nil {
-		return fmt.Errorf("start: %w", err)
+	if start {
+		prog.step(refNew, "starting container")
+		if _, err := cli.ContainerStart(ctx, created.ID, client.ContainerStartOptions{}); err != nil {
+			cctx, cancel := cleanupContext(ctx)
+			defer cancel()
+			_, _ = cli.ContainerRemove(cctx, created.ID, client.ContainerRemoveOptions{Force: true})
+			err = fmt.Errorf("start: %w", err)
+			if restorePrevContainer(cctx, cli, cur.ID, fullName, refOld, restart) {
+				err = rolledBack(err)
+			}
+			return nil, err
+		}
 	}
 
-	logContainerf(slog.LevelInfo, refNew, "updated successfully")
-	return nil
+	if opts.KeepOld {
+		prog.done()
+		logContainerf(slog.LevelInfo, refNew, "replaced, keeping old container until the group is done")
+		return &replacedContainer{ref: refOld, id: cur.ID, name: fullName, start: start}, nil
+	}
+
+	prog.step(refOld, "removing old container")
+	if _, err := cli.ContainerRemove(ctx, cur.ID, client.ContainerRemoveOptions{
+		Force:         false,
+		RemoveVolumes: false,
+	}); err != nil {
+		logContainerf(slog.LevelWarn, refOld, "remove old container: %v", err)
+	}
+
+	prog.done()
+	msg := "updated successfully"
+	if opts.Change != "" {
+		msg += " " + opts.Change
+	}
+	if !start {
+		msg += " (left stopped)"
+	}
+	logContainerf(slog.LevelInfo, refNew, "%s", msg)
+	return nil, nil
+}
+
+// restorePrevContainer puts the old container back under its name after a
+// failed recreate and reports whether it got its name back.
+func restorePrevContainer(ctx context.Context, cli *client.Client, id, name string, ref containerRef, start bool) bool {
+	logContainerf(slog.LevelWarn, ref, "restoring old container as %s", name)
+	if _, err := cli.ContainerRename(ctx, id, client.ContainerRenameOptions{NewName: name}); err != nil {
+		logContainerf(slog.LevelError, ref, "restore old container: rename: %v", err)
+		return false
+	}
+	ref.Name = name
+	if start {
+		restartOld(ctx, cli, id, ref)
+	}
+	return true
+}
+
+func restartOld(ctx context.Context, cli *client.Client, id string, ref containerRef) {
+	if _, err := cli.ContainerStart(ctx, id, client.ContainerStartOptions{}); err != nil {
+		logContainerf(slog.LevelError, ref, "restart old container: %v", err)
+	}
 }
 
-func rollingUpdateContainer(ctx context.Context, cli *client.Client, cur container.InspectResponse, imageRef string) error {
+func rollingUpdateContainer(ctx context.Context, cli *client.Client, plan *plannedUpdate, prog *progress) error {
+	cur, imageRef := plan.cur, plan.imageRef
 	refOld := containerRefFromInspect(cur)
 	fullName := strings.TrimPrefix(cur.Name, "/")
 	netCfg := buildNetworkingConfig(cur)
 
-	newConfig := cur.Config
-	newConfig.Image = imageRef
+	newConfig := newContainerConfig(ctx, cli, cur, imageRef)
 
-	tempName := fmt.Sprintf("%s.next", fullName)
+	tempName := fullName + nextSuffix
 	refNew := containerRef{Name: tempName, ID: ""}
-	logContainerf(slog.LevelInfo, refNew, "creating new container")
+	prog.step(refNew, "creating new container")
 	created, err := cli.ContainerCreate(ctx, client.ContainerCreateOptions{
 		Config:           newConfig,
 		HostConfig:       cur.HostConfig,
@@ -189,23 +494,24 @@ func rollingUpdateContainer(ctx context.Context, cli *client.Client, cur contain
 		logContainerf(slog.LevelWarn, refNew, "create warnings: %v", created.Warnings)
 	}
 
-	logContainerf(slog.LevelInfo, refNew, "starting new container")
+	prog.step(refNew, "starting new container")
 	if _, err := cli.ContainerStart(ctx, created.ID, client.ContainerStartOptions{}); err != nil {
-		_, _ = cli.ContainerRemove(ctx, created.ID, client.ContainerRemoveOptions{Force: true})
+		removeContainer(ctx, cli, created.ID)
 		return fmt.Errorf("start: %w", err)
 	}
 
+	prog.step(refNew, "waiting for new container to become healthy")
 	if err := waitForHealthyIfConfigured(ctx, cli, created.ID, 30*time.Second); err != nil {
-		_, _ = cli.ContainerRemove(ctx, created.ID, client.ContainerRemoveOptions{Force: true})
+		removeContainer(ctx, cli, created.ID)
 		return fmt.Errorf("health check: %w", err)
 	}
 
-	logContainerf(slog.LevelInfo, refOld, "stopping old container")
+	prog.step(refOld, "stopping old container")
 	if _, err := cli.ContainerStop(ctx, cur.ID, client.ContainerStopOptions{}); err != nil {
 		return fmt.Errorf("stop old: %w", err)
 	}
 
-	logContainerf(slog.LevelInfo, refOld, "removing old container")
+	prog.step(refOld, "removing old container")
 	if _, err := cli.ContainerRemove(ctx, cur.ID, client.ContainerRemoveOptions{
 		Force:         false,
 		RemoveVolumes: false,
@@ -213,13 +519,14 @@ func rollingUpdateContainer(ctx context.Context, cli *client.Client, cur contain
 		return fmt.Errorf("remove old: %w", err)
 	}
 
-	logContainerf(slog.LevelInfo, refNew, "renaming new container to %s", fullName)
+	prog.step(refNew, "renaming new container to %s", fullName)
 	if _, err := cli.ContainerRename(ctx, created.ID, client.ContainerRenameOptions{NewName: fullName}); err != nil {
 		return fmt.Errorf("rename: %w", err)
 	}
 
+	prog.done()
 	refNew.Name = fullName
-	logContainerf(slog.LevelInfo, refNew, "updated successfully")
+	logContainerf(slog.LevelInfo, refNew, "updated successfully %s", plan)
 	return nil
 }
 
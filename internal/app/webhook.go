@@ -0,0 +1,271 @@
+package app
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const webhookMaxBody = 1 << 20
+
+type webhookParser func(body []byte) ([]string, error)
+
+var webhookParsers = map[string]webhookParser{
+	"dockerhub":    parseDockerHubWebhook,
+	"ghcr":         parseGHCRWebhook,
+	"harbor":       parseHarborWebhook,
+	"gitlab":       parseDistributionWebhook,
+	"distribution": parseDistributionWebhook,
+}
+
+func serveWebhooks(ctx context.Context, cfg Config, triggers chan<- checkRequest, approvals *approvalStore) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /hooks/{provider}", func(w http.ResponseWriter, r *http.Request) {
+		handleWebhook(w, r, cfg.WebhookSecret, triggers)
+	})
+	registerApprovalRoutes(mux, cfg.WebhookSecret, approvals)
+
+	srv := &http.Server{
+		Addr:              cfg.WebhookAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	logf(slog.LevelInfo, "webhook receiver listening on %s", cfg.WebhookAddr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logf(slog.LevelError, "webhook receiver error: %v", err)
+	}
+}
+
+func handleWebhook(w http.ResponseWriter, r *http.Request, secret string, triggers chan<- checkRequest) {
+	provider := r.PathValue("provider")
+	parse, ok := webhookParsers[provider]
+	if !ok {
+		http.Error(w, "unknown provider", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, webhookMaxBody))
+	if err != nil {
+		http.Error(w, "read body", http.StatusBadRequest)
+		return
+	}
+	if !verifyWebhook(r, body, secret) {
+		logf(slog.LevelWarn, "webhook %s: rejected request from %s: bad secret or signature", provider, r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	refs, err := parse(body)
+	if err != nil {
+		logf(slog.LevelWarn, "webhook %s: %v", provider, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(refs) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	req := checkRequest{
+		ImageRefs: refs,
+		Reason:    fmt.Sprintf("%s webhook: %s", provider, strings.Join(refs, ", ")),
+	}
+	select {
+	case triggers <- req:
+	default:
+		http.Error(w, "check queue full", http.StatusServiceUnavailable)
+		return
+	}
+	logf(slog.LevelInfo, "webhook %s: push of %s", provider, strings.Join(refs, ", "))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// verifyWebhook accepts either an HMAC-SHA256 signature of the body or the
+// shared secret itself in one of the headers registries let you configure.
+func verifyWebhook(r *http.Request, body []byte, secret string) bool {
+	if secret == "" {
+		return false
+	}
+
+	for _, h := range []string{"X-Hub-Signature-256", "X-Signature-256"} {
+		sig := r.Header.Get(h)
+		if sig == "" {
+			continue
+		}
+		got, err := hex.DecodeString(strings.TrimPrefix(sig, "sha256="))
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return hmac.Equal(got, mac.Sum(nil))
+	}
+
+	candidates := []string{
+		r.Header.Get("X-Gitlab-Token"),
+		strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "),
+		r.URL.Query().Get("token"),
+	}
+	for _, c := range candidates {
+		if c != "" && subtle.ConstantTimeCompare([]byte(c), []byte(secret)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func parseDockerHubWebhook(body []byte) ([]string, error) {
+	var p struct {
+		PushData struct {
+			Tag string `json:"tag"`
+		} `json:"push_data"`
+		Repository struct {
+			RepoName string `json:"repo_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("decode payload: %w", err)
+	}
+	if p.Repository.RepoName == "" || p.PushData.Tag == "" {
+		return nil, errors.New("payload has no repository or tag")
+	}
+	return []string{"docker.io/" + p.Repository.RepoName + ":" + p.PushData.Tag}, nil
+}
+
+func parseGHCRWebhook(body []byte) ([]string, error) {
+	type ghPackage struct {
+		Name           string `json:"name"`
+		Namespace      string `json:"namespace"`
+		PackageType    string `json:"package_type"`
+		PackageVersion struct {
+			PackageURL        string `json:"package_url"`
+			ContainerMetadata struct {
+				Tag struct {
+					Name string `json:"name"`
+				} `json:"tag"`
+			} `json:"container_metadata"`
+		} `json:"package_version"`
+		Owner struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	}
+	var p struct {
+		Action          string     `json:"action"`
+		Package         *ghPackage `json:"package"`
+		RegistryPackage *ghPackage `json:"registry_package"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("decode payload: %w", err)
+	}
+	pkg := p.Package
+	if pkg == nil {
+		pkg = p.RegistryPackage
+	}
+	if pkg == nil {
+		return nil, errors.New("payload has no package")
+	}
+	if p.Action != "published" && p.Action != "updated" {
+		return nil, nil
+	}
+	if !strings.EqualFold(pkg.PackageType, "container") && !strings.EqualFold(pkg.PackageType, "docker") {
+		return nil, nil
+	}
+
+	tag := pkg.PackageVersion.ContainerMetadata.Tag.Name
+	if tag == "" {
+		return nil, nil
+	}
+	if u := pkg.PackageVersion.PackageURL; u != "" {
+		repo, _, _ := strings.Cut(strings.TrimPrefix(u, "https://"), "@")
+		if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+			repo = repo[:i]
+		}
+		return []string{repo + ":" + tag}, nil
+	}
+
+	owner := pkg.Namespace
+	if owner == "" {
+		owner = pkg.Owner.Login
+	}
+	if owner == "" || pkg.Name == "" {
+		return nil, errors.New("payload has no package owner or name")
+	}
+	return []string{strings.ToLower("ghcr.io/"+owner+"/"+pkg.Name) + ":" + tag}, nil
+}
+
+func parseHarborWebhook(body []byte) ([]string, error) {
+	var p struct {
+		Type      string `json:"type"`
+		EventData struct {
+			Resources []struct {
+				Tag         string `json:"tag"`
+				ResourceURL string `json:"resource_url"`
+			} `json:"resources"`
+		} `json:"event_data"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("decode payload: %w", err)
+	}
+	if p.Type != "PUSH_ARTIFACT" && p.Type != "pushImage" {
+		return nil, nil
+	}
+
+	var refs []string
+	for _, res := range p.EventData.Resources {
+		if res.ResourceURL == "" || res.Tag == "" {
+			continue
+		}
+		refs = append(refs, res.ResourceURL)
+	}
+	return refs, nil
+}
+
+// parseDistributionWebhook handles the registry notification envelope that
+// distribution (and registries built on it, such as GitLab's) sends.
+func parseDistributionWebhook(body []byte) ([]string, error) {
+	var p struct {
+		Events []struct {
+			Action string `json:"action"`
+			Target struct {
+				Repository string `json:"repository"`
+				Tag        string `json:"tag"`
+			} `json:"target"`
+			Request struct {
+				Host string `json:"host"`
+			} `json:"request"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("decode payload: %w", err)
+	}
+
+	var refs []string
+	for _, e := range p.Events {
+		if e.Action != "push" || e.Target.Tag == "" || e.Target.Repository == "" {
+			continue
+		}
+		repo := e.Target.Repository
+		if e.Request.Host != "" {
+			repo = e.Request.Host + "/" + repo
+		}
+		refs = append(refs, repo+":"+e.Target.Tag)
+	}
+	return refs, nil
+}
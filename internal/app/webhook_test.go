@@ -0,0 +1,200 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestWebhookParsers(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		body     string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "docker hub push",
+			provider: "dockerhub",
+			body: `{
+				"callback_url": "https://registry.hub.docker.com/u/acme/web/hook/1/",
+				"push_data": {"pushed_at": 1700000000, "pusher": "acme", "tag": "1.4"},
+				"repository": {"name": "web", "namespace": "acme", "repo_name": "acme/web"}
+			}`,
+			want: []string{"docker.io/acme/web:1.4"},
+		},
+		{
+			name:     "docker hub without tag",
+			provider: "dockerhub",
+			body:     `{"push_data": {}, "repository": {"repo_name": "acme/web"}}`,
+			wantErr:  true,
+		},
+		{
+			name:     "ghcr package published with package url",
+			provider: "ghcr",
+			body: `{
+				"action": "published",
+				"package": {
+					"name": "api",
+					"namespace": "Acme",
+					"package_type": "CONTAINER",
+					"package_version": {
+						"package_url": "ghcr.io/acme/api:2.0",
+						"container_metadata": {"tag": {"name": "2.0", "digest": "sha256:abc"}}
+					},
+					"owner": {"login": "Acme"}
+				}
+			}`,
+			want: []string{"ghcr.io/acme/api:2.0"},
+		},
+		{
+			name:     "ghcr registry package without package url",
+			provider: "ghcr",
+			body: `{
+				"action": "updated",
+				"registry_package": {
+					"name": "API",
+					"package_type": "docker",
+					"package_version": {"container_metadata": {"tag": {"name": "latest"}}},
+					"owner": {"login": "Acme"}
+				}
+			}`,
+			want: []string{"ghcr.io/acme/api:latest"},
+		},
+		{
+			name:     "ghcr untagged version",
+			provider: "ghcr",
+			body: `{
+				"action": "published",
+				"package": {
+					"name": "api",
+					"package_type": "container",
+					"package_version": {"container_metadata": {"tag": {"name": ""}}},
+					"owner": {"login": "acme"}
+				}
+			}`,
+		},
+		{
+			name:     "ghcr npm package",
+			provider: "ghcr",
+			body: `{
+				"action": "published",
+				"package": {
+					"name": "lib",
+					"package_type": "npm",
+					"package_version": {"container_metadata": {"tag": {"name": "1.0"}}},
+					"owner": {"login": "acme"}
+				}
+			}`,
+		},
+		{
+			name:     "ghcr without package",
+			provider: "ghcr",
+			body:     `{"action": "published"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "harbor push artifact",
+			provider: "harbor",
+			body: `{
+				"type": "PUSH_ARTIFACT",
+				"occur_at": 1700000000,
+				"operator": "admin",
+				"event_data": {
+					"resources": [
+						{"digest": "sha256:abc", "tag": "v3", "resource_url": "harbor.example.org/team/app:v3"},
+						{"digest": "sha256:def", "tag": "", "resource_url": "harbor.example.org/team/app@sha256:def"}
+					],
+					"repository": {"name": "app", "namespace": "team", "repo_full_name": "team/app"}
+				}
+			}`,
+			want: []string{"harbor.example.org/team/app:v3"},
+		},
+		{
+			name:     "harbor delete artifact",
+			provider: "harbor",
+			body:     `{"type": "DELETE_ARTIFACT", "event_data": {"resources": [{"tag": "v3", "resource_url": "harbor.example.org/team/app:v3"}]}}`,
+		},
+		{
+			name:     "gitlab push",
+			provider: "gitlab",
+			body: `{"events": [{
+				"id": "1",
+				"action": "push",
+				"target": {"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "repository": "group/project", "tag": "main"},
+				"request": {"host": "registry.gitlab.example.org"}
+			}]}`,
+			want: []string{"registry.gitlab.example.org/group/project:main"},
+		},
+		{
+			name:     "distribution skips pulls and digest pushes",
+			provider: "distribution",
+			body: `{"events": [
+				{"action": "pull", "target": {"repository": "app", "tag": "1"}, "request": {"host": "registry:5000"}},
+				{"action": "push", "target": {"repository": "app", "digest": "sha256:abc"}, "request": {"host": "registry:5000"}},
+				{"action": "push", "target": {"repository": "app", "tag": "2"}, "request": {"host": "registry:5000"}},
+				{"action": "push", "target": {"repository": "tools", "tag": "edge"}}
+			]}`,
+			want: []string{"registry:5000/app:2", "tools:edge"},
+		},
+		{
+			name:     "invalid json",
+			provider: "distribution",
+			body:     `{"events": [`,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := webhookParsers[tt.provider]([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("refs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	const secret = "s3cret"
+	body := []byte(`{"events": []}`)
+	// HMAC-SHA256 of body with secret.
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	sig := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name   string
+		target string
+		header map[string]string
+		secret string
+		want   bool
+	}{
+		{"hub signature", "/hooks/ghcr", map[string]string{"X-Hub-Signature-256": sig}, secret, true},
+		{"bad signature", "/hooks/ghcr", map[string]string{"X-Hub-Signature-256": "sha256=00"}, secret, false},
+		{"signature wins over token", "/hooks/ghcr?token=" + secret, map[string]string{"X-Signature-256": "sha256=zz"}, secret, false},
+		{"gitlab token", "/hooks/gitlab", map[string]string{"X-Gitlab-Token": secret}, secret, true},
+		{"bearer token", "/hooks/harbor", map[string]string{"Authorization": "Bearer " + secret}, secret, true},
+		{"query token", "/hooks/dockerhub?token=" + secret, nil, secret, true},
+		{"wrong token", "/hooks/dockerhub?token=guess", nil, secret, false},
+		{"no secret configured", "/hooks/dockerhub?token=", nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			if got := verifyWebhook(r, body, tt.secret); got != tt.want {
+				t.Errorf("verifyWebhook = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}